@@ -2,30 +2,28 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/afloesch/megamod/swizzle"
-	"github.com/manifoldco/promptui"
+	"github.com/afloesch/semver"
 	"github.com/spf13/cobra"
 )
 
 var (
+	addFile string
 	repo    string
 	repoVer string
 )
 
-func addPrompt() error {
-	prompt := promptui.Prompt{
-		Label:   "Repo",
-		Default: repo,
-	}
+func validateRepo(s string) error {
+	return swizzle.Repo(s).Validate()
+}
 
-	var err error
-	repo, err = prompt.Run()
-	if err != nil {
-		return err
+func validateRepoVersion(s string) error {
+	if s == "latest" {
+		return nil
 	}
-
-	return nil
+	return validateVersion(s)
 }
 
 var addCmd = &cobra.Command{
@@ -34,12 +32,16 @@ var addCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx := context.Background()
 
-		err := addPrompt()
-		if err != nil {
+		var err error
+		if repo, err = inputValue(cmd, "repo", "Repo", true, validateRepo); err != nil {
+			return err
+		}
+		if repoVer, err = inputValue(cmd, "version", "Version", true, validateRepoVersion); err != nil {
 			return err
 		}
 
-		mod, err := swizzle.New().ReadFile("./swizzle.yml")
+		file := manifestPath(cmd, addFile)
+		mod, err := swizzle.New().ReadFile(file)
 		if err != nil {
 			return err
 		}
@@ -59,11 +61,24 @@ var addCmd = &cobra.Command{
 			return err
 		}
 
-		return mod.WriteFile("./swizzle.yml")
+		err = mod.WriteFile(file)
+		if err != nil {
+			return err
+		}
+
+		res := struct {
+			Repo       string                         `json:"repo"`
+			Version    string                         `json:"version"`
+			Dependency map[swizzle.Repo]semver.String `json:"dependency"`
+		}{repo, ver, mod.Dependency}
+		return printResult(res, func() {
+			fmt.Printf("Added %s %s\n", repo, ver)
+		})
 	},
 }
 
 func init() {
+	addCmd.PersistentFlags().StringVarP(&addFile, "file", "f", defManifestFile, "Swizzle manifest file.")
 	addCmd.PersistentFlags().StringVarP(&repo, "repo", "r", "", "Github repository.")
 	addCmd.PersistentFlags().StringVarP(&repoVer, "version", "v", "latest", "Release version.")
 	rootCmd.AddCommand(addCmd)
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/inhies/go-bytesize"
+	"github.com/spf13/cobra"
+)
+
+var bundleFile string
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Pack a resolved manifest for installing without network access.",
+}
+
+var bundleCreateCmd = &cobra.Command{
+	Use:   "create <out.tar>",
+	Short: "Pack the manifest, lock, release manifests and release files into one file.",
+	Long: `Pack the manifest, the resolved lock, the release manifest of every
+dependency and every release file into one tar file. Release files missing
+from the cache are downloaded first. Install the bundle on another machine
+with 'swizzle install --from-bundle <file>'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := interruptContext()
+		defer stop()
+
+		mod, err := swizzle.New().ReadFile(manifestPath(cmd, bundleFile))
+		if err != nil {
+			return err
+		}
+		game, err := gameForManifest(mod)
+		if err != nil {
+			return err
+		}
+
+		graph, err := mod.Graph(ctx)
+		if err != nil {
+			return err
+		}
+		for _, n := range graph.InstallOrder() {
+			m := n.Manifest()
+			for _, f := range m.Files {
+				if err := downloadFile(ctx, m, f, game.CacheDir()); err != nil {
+					return err
+				}
+			}
+		}
+
+		b, err := swizzle.CreateBundle(args[0], mod, graph, game.CacheDir())
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(b.Path)
+		if err != nil {
+			return err
+		}
+
+		res := struct {
+			File string               `json:"file"`
+			Size int64                `json:"size"`
+			Mods []*swizzle.LockedMod `json:"mods"`
+		}{b.Path, info.Size(), b.Lock.Mods}
+		return printResult(res, func() {
+			for _, m := range res.Mods {
+				fmt.Printf("Bundled %s %s\n", m.Repo, m.Version)
+			}
+			fmt.Printf("Bundle created: %s (%s)\n", res.File, bytesize.New(float64(res.Size)))
+		})
+	},
+}
+
+func init() {
+	bundleCmd.PersistentFlags().StringVarP(&bundleFile, "file", "f", defManifestFile, "Swizzle manifest file.")
+	bundleCmd.AddCommand(bundleCreateCmd)
+	rootCmd.AddCommand(bundleCmd)
+}
@@ -1,21 +1,43 @@
 package cmd
 
 import (
-	"fmt"
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
 
 var rootCmd = &cobra.Command{
-	Use:     "swizzle",
-	Aliases: []string{"swz"},
-	Short:   "Swizzle command line utilities for managing mod downloads.",
+	Use:           "swizzle",
+	Aliases:       []string{"swz"},
+	Short:         "Swizzle command line utilities for managing mod downloads.",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateOutput(); err != nil {
+			return err
+		}
+		return loadConfig(cmd)
+	},
+}
+
+// interruptContext returns a context canceled on Ctrl-C or SIGTERM, so
+// installs in progress are rolled back.
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 }
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		printError(err)
 		os.Exit(1)
 	}
 }
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", textOutput, "Output format, one of text or json.")
+	rootCmd.PersistentFlags().BoolVar(&noInput, "no-input", false, "Disable all prompts and read values only from flags and environment variables.")
+	rootCmd.PersistentFlags().BoolVarP(&noInput, "yes", "y", false, "Alias for --no-input.")
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/spf13/cobra"
+)
+
+const defManifestFile string = "swizzle.yml"
+
+var (
+	configFile string
+	gameName   string
+
+	config *swizzle.Config
+)
+
+// loadConfig reads the swizzle config file and sets the GitHub token for the
+// selected game profile.
+func loadConfig(cmd *cobra.Command) error {
+	var err error
+	config, err = swizzle.LoadConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	if !cmd.Flags().Changed("game") {
+		gameName = os.Getenv(envName("game"))
+	}
+
+	token := config.Token
+	if gameName != "" {
+		g, err := config.Game(gameName)
+		if err != nil {
+			return err
+		}
+		token = g.GitHubToken()
+	}
+	if t := os.Getenv("GITHUB_TOKEN"); token == "" && t != "" {
+		token = t
+	}
+	swizzle.SetToken(token)
+
+	return nil
+}
+
+// selectedGame returns the game selected with the --game flag, or nil if no
+// game was selected.
+func selectedGame() *swizzle.GameConfig {
+	if gameName == "" {
+		return nil
+	}
+	g, _ := config.Game(gameName)
+	return g
+}
+
+// manifestPath returns the manifest file for a command. An explicit --file
+// flag takes precedence over the manifest configured for the selected game.
+func manifestPath(cmd *cobra.Command, file string) string {
+	if cmd.Flags().Changed("file") {
+		return file
+	}
+	if g := selectedGame(); g != nil && g.Manifest != "" {
+		return g.ManifestFile()
+	}
+	return file
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", swizzle.DefaultConfigPath(), "Swizzle config file.")
+	rootCmd.PersistentFlags().StringVar(&gameName, "game", "", "Configured game name from the config file.")
+}
+
+// gameForManifest returns the game selected with the --game flag, or the single
+// configured game matching the manifest game executable.
+func gameForManifest(m *swizzle.Manifest) (*swizzle.GameConfig, error) {
+	if g := selectedGame(); g != nil {
+		return g, nil
+	}
+	if g, ok := config.MatchGame(m); ok {
+		return g, nil
+	}
+	return nil, swizzle.NewError(
+		swizzle.ErrCodeInvalidInput,
+		"",
+		"",
+		fmt.Errorf("no configured game for '%s': set --game", m.Game.Executable),
+	)
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/spf13/cobra"
+)
+
+var conflictsFile string
+
+var conflictsCmd = &cobra.Command{
+	Use:   "conflicts",
+	Short: "List files provided by more than one installed mod, including files packed in BSA and BA2 archives and INI keys.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inst, err := readInstalled(cmd, conflictsFile)
+		if err != nil {
+			return err
+		}
+
+		mod, mods, err := applyActiveProfile(inst.staging, inst.mod, inst.lock.Mods, nil)
+		if err != nil {
+			return err
+		}
+		plan, err := inst.staging.Plan(mod, mods)
+		if err != nil {
+			return err
+		}
+
+		lo, err := inst.staging.LoadOrder(inst.game)
+		if err != nil {
+			return err
+		}
+		archives, err := plan.ArchiveConflicts(lo)
+		if err != nil {
+			return err
+		}
+
+		res := struct {
+			Conflicts        []*swizzle.Conflict        `json:"conflicts"`
+			ArchiveConflicts []*swizzle.ArchiveConflict `json:"archiveConflicts"`
+			INIConflicts     []*swizzle.INIConflict     `json:"iniConflicts"`
+		}{plan.Conflicts, archives, plan.INIConflicts}
+
+		return printResult(res, func() {
+			for _, c := range plan.Conflicts {
+				mods := make([]string, len(c.Mods))
+				for i, m := range c.Mods {
+					mods[i] = m.String()
+				}
+
+				winner := c.Winner.String()
+				if c.Override {
+					winner += " (override)"
+				}
+				fmt.Printf("%s:%s\n  %s\n  winner: %s\n", c.Root, c.Path, strings.Join(mods, ", "), winner)
+			}
+			for _, c := range archives {
+				providers := make([]string, len(c.Providers))
+				for i, p := range c.Providers {
+					providers[i] = assetProvider(p)
+				}
+				fmt.Printf("Data/%s\n  %s\n  winner: %s\n", c.Path, strings.Join(providers, ", "), assetProvider(c.Winner))
+			}
+			for _, c := range plan.INIConflicts {
+				fmt.Printf("%s:%s [%s] %s\n  %s\n  winner: %s\n", c.Root, c.File, c.Section, c.Key, iniSetters(c), iniSetter(c.Winner))
+			}
+			fmt.Printf("%d conflicts, %d archive conflicts, %d INI conflicts\n", len(plan.Conflicts), len(archives), len(plan.INIConflicts))
+		})
+	},
+}
+
+// assetProvider formats a mod providing an asset, with the archive containing
+// the asset.
+func assetProvider(p *swizzle.AssetProvider) string {
+	if p.Archive == "" {
+		return p.Repo.String() + " (loose)"
+	}
+	return fmt.Sprintf("%s (%s)", p.Repo, p.Archive)
+}
+
+func init() {
+	conflictsCmd.PersistentFlags().StringVarP(&conflictsFile, "file", "f", defManifestFile, "Swizzle manifest file.")
+	rootCmd.AddCommand(conflictsCmd)
+}
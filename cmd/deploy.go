@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/spf13/cobra"
+)
+
+var (
+	deployFile   string
+	deployMethod string
+)
+
+// installed is an installed manifest with the lock file and game for the
+// manifest.
+type installed struct {
+	mod     *swizzle.Manifest
+	game    *swizzle.GameConfig
+	lock    *swizzle.Lock
+	staging *swizzle.Staging
+}
+
+// readInstalled reads the manifest and lock file for a command, and finds the
+// game for the manifest.
+func readInstalled(cmd *cobra.Command, file string) (*installed, error) {
+	path := manifestPath(cmd, file)
+	mod, err := swizzle.New().ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	game, err := gameForManifest(mod)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := swizzle.ReadLock(swizzle.LockPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("missing lock file, run 'swizzle install' first: %w", err)
+	}
+
+	return &installed{
+		mod:     mod,
+		game:    game,
+		lock:    lock,
+		staging: swizzle.NewStaging(game.StagingDir()),
+	}, nil
+}
+
+// deployResult is a deployment, the masters missing for deployed plugins, the
+// plugins which could not be checked for masters, the INI keys set differently
+// by mods, and the plugin load order written for the deployment.
+type deployResult struct {
+	*swizzle.Deployment
+	MissingMasters    []*swizzle.MissingMaster    `json:"missingMasters,omitempty"`
+	UnreadablePlugins []*swizzle.UnreadablePlugin `json:"unreadablePlugins,omitempty"`
+	INIConflicts      []*swizzle.INIConflict      `json:"iniConflicts,omitempty"`
+	LoadOrder         *swizzle.LoadOrder          `json:"loadOrder,omitempty"`
+}
+
+// printLoadOrder prints the number of plugins written to the load order, and a
+// warning for each plugin left out of the load order.
+func printLoadOrder(lo *swizzle.LoadOrder) {
+	if lo == nil {
+		return
+	}
+	if len(lo.Plugins) > 0 {
+		fmt.Printf("%d plugins written to %s\n", len(lo.Plugins), swizzle.PluginsFileName)
+	}
+	for _, p := range lo.Skipped {
+		fmt.Printf("Warning: %s could not be read and was left out of the load order: %s\n", p.Plugin, p.Error)
+	}
+}
+
+// printMissingMasters prints a warning for each plugin master which is not
+// provided by any mod or the base game.
+func printMissingMasters(missing []*swizzle.MissingMaster) {
+	for _, m := range missing {
+		fmt.Printf("Warning: %s (%s) requires master %s, which no mod or the base game provides\n", m.Plugin, m.Repo, m.Master)
+	}
+}
+
+// printUnreadablePlugins prints a warning for each plugin which could not be
+// read.
+func printUnreadablePlugins(unreadable []*swizzle.UnreadablePlugin) {
+	for _, p := range unreadable {
+		fmt.Printf("Warning: %s (%s) could not be read, its masters were not checked: %s\n", p.Plugin, p.Repo, p.Error)
+	}
+}
+
+// printINIConflicts prints a warning for each INI key set to different values
+// by more than one mod.
+func printINIConflicts(conflicts []*swizzle.INIConflict) {
+	for _, c := range conflicts {
+		fmt.Printf("Warning: %s [%s] %s is set by %s, using %s\n", c.File, c.Section, c.Key, iniSetters(c), iniSetter(c.Winner))
+	}
+}
+
+// iniSetters formats the mods and values set for a conflicting INI key.
+func iniSetters(c *swizzle.INIConflict) string {
+	s := make([]string, len(c.Settings))
+	for i, set := range c.Settings {
+		s[i] = fmt.Sprintf("%s=%s", iniSetter(set.Repo), set.Value)
+	}
+	return strings.Join(s, ", ")
+}
+
+// iniSetter names the mod setting an INI value, where an empty repo is the
+// root manifest.
+func iniSetter(repo swizzle.Repo) string {
+	if repo == "" {
+		return "manifest"
+	}
+	return repo.String()
+}
+
+// rollback rolls back a transaction and returns the original error.
+func rollback(tx *swizzle.Transaction, err error) error {
+	if rerr := tx.Rollback(); rerr != nil {
+		return fmt.Errorf("%w: rollback failed: %s", err, rerr)
+	}
+	return err
+}
+
+// manifestGame reads the manifest for a command and returns the game and
+// staging directory for the manifest.
+func manifestGame(cmd *cobra.Command, file string) (*swizzle.GameConfig, *swizzle.Staging, error) {
+	mod, err := swizzle.New().ReadFile(manifestPath(cmd, file))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	game, err := gameForManifest(mod)
+	if err != nil {
+		return nil, nil, err
+	}
+	return game, swizzle.NewStaging(game.StagingDir()), nil
+}
+
+var deployCmd = &cobra.Command{
+	Use:   "deploy",
+	Short: "Deploy all staged mods in the lock file to the game.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := interruptContext()
+		defer stop()
+
+		inst, err := readInstalled(cmd, deployFile)
+		if err != nil {
+			return err
+		}
+
+		mod, mods, err := applyActiveProfile(inst.staging, inst.mod, inst.lock.Mods, nil)
+		if err != nil {
+			return err
+		}
+		plan, err := inst.staging.Plan(mod, mods)
+		if err != nil {
+			return err
+		}
+
+		missing, unreadable, err := inst.staging.MissingMasters(inst.game, plan)
+		if err != nil {
+			return err
+		}
+
+		tx, err := inst.staging.Begin(inst.game)
+		if err != nil {
+			return err
+		}
+		d, err := tx.Deploy(ctx, plan, swizzle.DeployMethod(deployMethod))
+		if err != nil {
+			return rollback(tx, err)
+		}
+		lo, err := tx.WriteLoadOrder()
+		if err != nil {
+			return rollback(tx, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		return printResult(&deployResult{d, missing, unreadable, plan.INIConflicts, lo}, func() {
+			fmt.Printf("%d files deployed to %s\n", len(d.Files), inst.game.GameDir())
+			printMissingMasters(missing)
+			printUnreadablePlugins(unreadable)
+			printINIConflicts(plan.INIConflicts)
+			printLoadOrder(lo)
+		})
+	},
+}
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Remove all deployed mod files from the game and restore original files.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		game, staging, err := manifestGame(cmd, deployFile)
+		if err != nil {
+			return err
+		}
+
+		d, err := staging.Purge(game)
+		if err != nil {
+			return err
+		}
+		if _, err := staging.WriteLoadOrder(game); err != nil {
+			return err
+		}
+
+		return printResult(d, func() {
+			fmt.Printf("%d files removed from %s\n", len(d.Files), game.GameDir())
+		})
+	},
+}
+
+func init() {
+	deployCmd.PersistentFlags().StringVarP(&deployFile, "file", "f", defManifestFile, "Swizzle manifest file.")
+	deployCmd.PersistentFlags().StringVarP(&deployMethod, "method", "m", string(swizzle.HardlinkDeploy), "Deploy method, one of hardlink, symlink, or copy.")
+	purgeCmd.PersistentFlags().StringVarP(&deployFile, "file", "f", defManifestFile, "Swizzle manifest file.")
+	rootCmd.AddCommand(deployCmd)
+	rootCmd.AddCommand(purgeCmd)
+}
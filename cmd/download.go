@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/afloesch/megamod/swizzle"
+)
+
+// downloadFile downloads a release file to the cache directory, unless the
+// release file is already cached. Progress is written to stderr for text output.
+func downloadFile(ctx context.Context, mod *swizzle.Manifest, file *swizzle.ReleaseFile, cache string) error {
+	if file.Cached(cache, mod) {
+		return nil
+	}
+
+	done, prog, errCh := mod.DownloadReleaseFile(ctx, file, cache)
+	for {
+		select {
+		case <-done:
+			if !isJSON() {
+				fmt.Fprintln(os.Stderr)
+			}
+			return nil
+		case p := <-prog:
+			if !isJSON() {
+				fmt.Fprintf(os.Stderr, "\r%s %v%% of %v", file.Name, math.Floor(p), file.Size())
+			}
+		case err := <-errCh:
+			return err
+		}
+	}
+}
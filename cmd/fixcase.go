@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/spf13/cobra"
+)
+
+var fixCaseDryRun bool
+
+// gameDir returns the directory argument, or the directory of the selected game.
+func gameDir(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	if g := selectedGame(); g != nil {
+		return g.GameDir(), nil
+	}
+	return "", swizzle.NewError(
+		swizzle.ErrCodeInvalidInput,
+		"",
+		"",
+		fmt.Errorf("missing game directory: pass a directory or set --game"),
+	)
+}
+
+var fixCaseCmd = &cobra.Command{
+	Use:   "fix-case [dir]",
+	Short: "Merge files and directories in a game directory which differ only by case.",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := gameDir(args)
+		if err != nil {
+			return err
+		}
+
+		fixes, err := swizzle.FixCase(dir, fixCaseDryRun)
+		if err != nil {
+			return err
+		}
+
+		res := struct {
+			Directory string            `json:"directory"`
+			DryRun    bool              `json:"dryRun"`
+			Fixes     []swizzle.CaseFix `json:"fixes"`
+		}{dir, fixCaseDryRun, fixes}
+		return printResult(res, func() {
+			for _, f := range fixes {
+				action := "merged"
+				if f.Replaced {
+					action = "replaced"
+				}
+				fmt.Printf("%s %s -> %s\n", action, f.From, f.To)
+			}
+			fmt.Printf("%d paths fixed in %s\n", len(fixes), dir)
+		})
+	},
+}
+
+func init() {
+	fixCaseCmd.PersistentFlags().BoolVar(&fixCaseDryRun, "dry-run", false, "Print the fixes without changing any files.")
+	rootCmd.AddCommand(fixCaseCmd)
+}
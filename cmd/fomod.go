@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	fomodFile   string
+	fomodSource string
+)
+
+// fomodItem is a FOMOD option shown in a prompt.
+type fomodItem struct {
+	Label       string
+	Description string
+}
+
+// fomodPrompt selects FOMOD options interactively. The name identifies the
+// archive in prompt labels.
+type fomodPrompt struct {
+	name string
+}
+
+// SelectOptions prompts for the options in a FOMOD group. Groups with a
+// single choice use a select prompt, and other groups toggle options until
+// Done is selected.
+func (p fomodPrompt) SelectOptions(step *swizzle.FomodStep, group *swizzle.FomodGroup, options []*swizzle.FomodOption) ([]string, error) {
+	defaults, err := swizzle.DefaultFomodSelector{}.SelectOptions(step, group, options)
+	if err != nil {
+		return nil, err
+	}
+
+	label := fmt.Sprintf("%s: %s / %s", p.name, step.Name, group.Name)
+	templates := &promptui.SelectTemplates{
+		Details: "{{ .Description }}",
+	}
+
+	switch group.Type {
+	case swizzle.SelectAll:
+		return defaults, nil
+
+	case swizzle.SelectExactlyOne, swizzle.SelectAtMostOne:
+		var items []fomodItem
+		if group.Type == swizzle.SelectAtMostOne {
+			items = append(items, fomodItem{Label: "None"})
+		}
+		cursor := 0
+		for _, o := range options {
+			if len(defaults) > 0 && o.Name == defaults[0] {
+				cursor = len(items)
+			}
+			items = append(items, fomodItem{Label: optionLabel(o), Description: o.Description})
+		}
+
+		sel := promptui.Select{
+			Label:     label,
+			Items:     items,
+			Templates: templates,
+			CursorPos: cursor,
+			Size:      10,
+		}
+		i, _, err := sel.Run()
+		if err != nil {
+			return nil, err
+		}
+		if group.Type == swizzle.SelectAtMostOne {
+			if i == 0 {
+				return nil, nil
+			}
+			i--
+		}
+		return []string{options[i].Name}, nil
+	}
+
+	selected := map[string]bool{}
+	for _, name := range defaults {
+		selected[name] = true
+	}
+
+	cursor := 0
+	for {
+		items := []fomodItem{{Label: "Done"}}
+		for _, o := range options {
+			mark := "[ ]"
+			if selected[o.Name] {
+				mark = "[x]"
+			}
+			items = append(items, fomodItem{Label: mark + " " + optionLabel(o), Description: o.Description})
+		}
+
+		sel := promptui.Select{
+			Label:     label,
+			Items:     items,
+			Templates: templates,
+			CursorPos: cursor,
+			Size:      10,
+		}
+		i, _, err := sel.Run()
+		if err != nil {
+			return nil, err
+		}
+		cursor = i
+
+		if i == 0 {
+			var names []string
+			for _, o := range options {
+				if selected[o.Name] {
+					names = append(names, o.Name)
+				}
+			}
+			if group.Type == swizzle.SelectAtLeastOne && len(names) == 0 {
+				fmt.Println("Select at least one option.")
+				continue
+			}
+			return names, nil
+		}
+
+		o := options[i-1]
+		if o.Type != swizzle.RequiredPlugin && o.Type != swizzle.NotUsablePlugin {
+			selected[o.Name] = !selected[o.Name]
+		}
+	}
+}
+
+// optionLabel returns the prompt label for a FOMOD option, noting options
+// which are not optional.
+func optionLabel(o *swizzle.FomodOption) string {
+	switch o.Type {
+	case swizzle.RequiredPlugin, swizzle.RecommendedPlugin, swizzle.NotUsablePlugin, swizzle.CouldBeUsablePlugin:
+		return fmt.Sprintf("%s (%s)", o.Name, o.Type)
+	}
+	return o.Name
+}
+
+// stageOptions returns the options for staging mods for a game. FOMOD file
+// dependencies use the current game load order, and FOMOD options are
+// prompted for when input is interactive.
+func stageOptions(staging *swizzle.Staging, game *swizzle.GameConfig) []swizzle.StageOption {
+	var opts []swizzle.StageOption
+	if lo, err := staging.LoadOrder(game); err == nil {
+		opts = append(opts, swizzle.WithFileState(swizzle.FomodFileStates(lo)))
+	}
+
+	if interactive() {
+		opts = append(opts, swizzle.WithFomodSelector(func(m *swizzle.Manifest, f *swizzle.ReleaseFile) swizzle.FomodSelector {
+			return fomodPrompt{name: fmt.Sprintf("%s %s", m.Repo, f.Name)}
+		}))
+	}
+	return opts
+}
+
+var fomodCmd = &cobra.Command{
+	Use:   "fomod",
+	Short: "Work with FOMOD installers in mod archives.",
+}
+
+var fomodRecordCmd = &cobra.Command{
+	Use:   "record <archive>",
+	Short: "Run the FOMOD installer in an archive and print the choices for the manifest.",
+	Long: `Run the FOMOD installer in an archive and print the selected options as a
+choices block for the release file in the manifest. Options are prompted for
+when input is interactive, otherwise the default options are recorded.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		archive := swizzle.NewArchive(filepath.Base(args[0]), filepath.Dir(args[0]))
+		config, err := swizzle.ReadArchiveFomod(archive, fomodSource)
+		if err != nil {
+			return err
+		}
+
+		// file dependencies use the game load order when there is a manifest
+		var fileState func(string) swizzle.FomodFileState
+		if game, staging, err := manifestGame(cmd, fomodFile); err == nil {
+			if lo, err := staging.LoadOrder(game); err == nil {
+				fileState = swizzle.FomodFileStates(lo)
+			}
+		}
+
+		var sel swizzle.FomodSelector = swizzle.DefaultFomodSelector{}
+		if interactive() {
+			name := config.ModuleName
+			if name == "" {
+				name = filepath.Base(args[0])
+			}
+			sel = fomodPrompt{name: name}
+		}
+
+		inst, err := config.Install(sel, fileState)
+		if err != nil {
+			return err
+		}
+
+		return printResult(inst.Choices, func() {
+			out, err := yaml.Marshal(struct {
+				Choices []*swizzle.FomodStepChoice `yaml:"choices"`
+			}{inst.Choices})
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Print(string(out))
+		})
+	},
+}
+
+func init() {
+	fomodRecordCmd.PersistentFlags().StringVarP(&fomodFile, "file", "f", defManifestFile, "Swizzle manifest file, for the game load order used by FOMOD file dependencies.")
+	fomodRecordCmd.PersistentFlags().StringVarP(&fomodSource, "source", "s", "", "Path to the mod content inside the archive.")
+	fomodCmd.AddCommand(fomodRecordCmd)
+	rootCmd.AddCommand(fomodCmd)
+}
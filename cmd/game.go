@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gameListFile string
+	gameListExe  string
+	gameListAll  bool
+)
+
+var gameCmd = &cobra.Command{
+	Use:   "game",
+	Short: "Manage game installs.",
+}
+
+var gameListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List configured games and game installs found in Steam libraries.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		exe := gameListExe
+		if exe == "" && !gameListAll {
+			file := manifestPath(cmd, gameListFile)
+			if _, err := os.Stat(file); err == nil {
+				mod, err := swizzle.New().ReadFile(file)
+				if err != nil {
+					return err
+				}
+				exe = mod.Game.Executable
+			}
+		}
+
+		var installs []*swizzle.SteamGame
+		var err error
+		if exe == "" {
+			installs, err = swizzle.FindSteamGames()
+		} else {
+			installs, err = swizzle.FindGameInstalls(exe)
+		}
+		if err != nil {
+			return err
+		}
+
+		var games []*swizzle.GameConfig
+		for _, name := range config.GameNames() {
+			games = append(games, config.Games[name])
+		}
+
+		res := struct {
+			Configured []*swizzle.GameConfig `json:"configured"`
+			Steam      []*swizzle.SteamGame  `json:"steam"`
+		}{games, installs}
+		return printResult(res, func() {
+			fmt.Println("Configured games:")
+			if len(games) == 0 {
+				fmt.Println("  none")
+			}
+			for _, g := range games {
+				fmt.Printf("  %s\t%s\t%s\n", g.Name, g.Executable, g.GameDir())
+				for _, root := range []swizzle.InstallRoot{swizzle.DocumentsRoot, swizzle.AppDataRoot} {
+					if dir, err := g.RootDir(root); err == nil {
+						fmt.Printf("    %s: %s\n", root, dir)
+					}
+				}
+			}
+
+			if exe != "" {
+				fmt.Printf("\nSteam installs with %s:\n", exe)
+			} else {
+				fmt.Println("\nSteam installs:")
+			}
+			if len(installs) == 0 {
+				fmt.Println("  none")
+			}
+			for _, g := range installs {
+				fmt.Printf("  %s (%s)\t%s\n", g.Name, g.AppID, g.Directory)
+			}
+		})
+	},
+}
+
+func init() {
+	gameListCmd.PersistentFlags().StringVarP(&gameListFile, "file", "f", defManifestFile, "Swizzle manifest file used to match the game executable.")
+	gameListCmd.PersistentFlags().StringVarP(&gameListExe, "exe", "e", "", "Only list Steam installs containing the game executable.")
+	gameListCmd.PersistentFlags().BoolVarP(&gameListAll, "all", "a", false, "List all Steam installs.")
+	gameCmd.AddCommand(gameListCmd)
+	rootCmd.AddCommand(gameCmd)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/spf13/cobra"
+)
+
+var (
+	graphFile   string
+	graphFormat string
+)
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Render the resolved dependency graph for a manifest.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		mod, err := swizzle.New().ReadFile(manifestPath(cmd, graphFile))
+		if err != nil {
+			return err
+		}
+
+		g, err := mod.Graph(ctx)
+		if err != nil {
+			return err
+		}
+
+		format := graphFormat
+		if isJSON() && !cmd.Flags().Changed("format") {
+			format = "json"
+		}
+
+		switch format {
+		case "dot":
+			fmt.Print(g.DOT())
+		case "mermaid":
+			fmt.Print(g.Mermaid())
+		case "json":
+			return printJSON(g)
+		default:
+			return fmt.Errorf("unknown graph format '%s'", format)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	graphCmd.PersistentFlags().StringVarP(&graphFile, "file", "f", defManifestFile, "Swizzle manifest file.")
+	graphCmd.PersistentFlags().StringVar(&graphFormat, "format", "dot", "Output format, one of dot, mermaid, or json.")
+	rootCmd.AddCommand(graphCmd)
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/afloesch/semver"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFile    string
+	importMapping string
+	importModsDir string
+	importExe     string
+	importProfile string
+	importForce   bool
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Create a swizzle manifest from another mod manager.",
+}
+
+var importMO2Cmd = &cobra.Command{
+	Use:   "mo2 <profile-dir>",
+	Short: "Create a swizzle manifest from a Mod Organizer 2 profile.",
+	Long: `Create a swizzle manifest from a Mod Organizer 2 profile. Enabled mods in
+modlist.txt are added as dependencies, with the manifest priority following the
+Mod Organizer 2 mod priority. Mods are mapped to GitHub repos with a YAML
+mapping file keyed by the mod name, or by the Nexus Mods id from the mod
+meta.ini in the form nexus:<id>, with an optional version after an @:
+
+  SkyUI: owner/skyui@>=v5.2.0
+  nexus:12604: owner/skyui
+
+Mods without a mapping are listed and left out of the manifest. The profile
+plugins.txt load order is saved to a swizzle profile when --profile is set.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := manifestPath(cmd, importFile)
+		if _, err := os.Stat(file); err == nil && !importForce {
+			return swizzle.NewError(swizzle.ErrCodeInvalidInput, "", "", fmt.Errorf("manifest '%s' already exists, use --force to replace it", file))
+		}
+
+		mapping := swizzle.MO2Mapping{}
+		if importMapping != "" {
+			var err error
+			if mapping, err = swizzle.ReadMO2Mapping(importMapping); err != nil {
+				return err
+			}
+		}
+
+		// profiles are in <instance>/profiles/<name>, next to the mods directory
+		modsDir := importModsDir
+		if modsDir == "" {
+			modsDir = filepath.Join(args[0], "..", "..", "mods")
+		}
+		mo2, err := swizzle.ReadMO2Profile(args[0], modsDir)
+		if err != nil {
+			return err
+		}
+
+		m := swizzle.New()
+		m.Name = mo2.Name
+		m.Game.Executable = importExe
+		if g := selectedGame(); g != nil && importExe == "" {
+			m.Game.Executable = g.Executable
+		}
+		m.Game.Version = semver.String(defGameVer)
+
+		imp, err := mo2.Import(m, mapping)
+		if err != nil {
+			return err
+		}
+
+		// the game and profile are checked before writing the manifest, so a
+		// missing game config or an existing profile does not leave a partial
+		// import
+		var staging *swizzle.Staging
+		var profile *swizzle.Profile
+		if importProfile != "" {
+			game, err := gameForManifest(m)
+			if err != nil {
+				return err
+			}
+			staging = swizzle.NewStaging(game.StagingDir())
+			profile = &swizzle.Profile{Name: importProfile, LoadOrder: mo2.Plugins}
+			for repo := range m.Dependency {
+				profile.Mods = append(profile.Mods, repo)
+			}
+			if err := staging.ValidateProfile(m, profile); err != nil {
+				return err
+			}
+		}
+		if err := m.WriteFile(file); err != nil {
+			return err
+		}
+
+		if profile != nil {
+			if err := staging.CreateProfile(m, profile); err != nil {
+				return err
+			}
+		}
+
+		res := struct {
+			File    string             `json:"file"`
+			Profile *swizzle.Profile   `json:"profile,omitempty"`
+			Import  *swizzle.MO2Import `json:"import"`
+		}{file, profile, imp}
+		return printResult(res, func() {
+			fmt.Printf("Manifest created: %s (%d of %d enabled mods mapped)\n", file, len(imp.Mapped), len(imp.Mapped)+len(imp.Unmapped))
+			if profile != nil {
+				fmt.Printf("Created profile %s with %d plugins\n", profile.Name, len(profile.LoadOrder))
+			}
+			if len(imp.Unmapped) > 0 {
+				fmt.Println("Unmapped mods:")
+			}
+			for _, mod := range imp.Unmapped {
+				if mod.NexusID > 0 {
+					fmt.Printf("  %s (nexus:%d)\n", mod.Name, mod.NexusID)
+					continue
+				}
+				fmt.Printf("  %s\n", mod.Name)
+			}
+		})
+	},
+}
+
+func init() {
+	importCmd.PersistentFlags().StringVarP(&importFile, "file", "f", defManifestFile, "Swizzle manifest file to create.")
+	importCmd.PersistentFlags().BoolVar(&importForce, "force", false, "Replace an existing manifest file.")
+	importMO2Cmd.PersistentFlags().StringVarP(&importMapping, "mapping", "m", "", "YAML file mapping mod names or Nexus Mods ids to GitHub repos.")
+	importMO2Cmd.PersistentFlags().StringVar(&importModsDir, "mods", "", "Mod Organizer 2 mods directory. Defaults to the mods directory of the profile instance.")
+	importMO2Cmd.PersistentFlags().StringVarP(&importExe, "exe", "e", "", "The game executable for the manifest. Defaults to the selected game.")
+	importMO2Cmd.PersistentFlags().StringVarP(&importProfile, "profile", "p", "", "Save the enabled mods and plugin load order to a swizzle profile.")
+	importCmd.AddCommand(importMO2Cmd)
+	rootCmd.AddCommand(importCmd)
+}
@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/afloesch/semver"
+	"github.com/inhies/go-bytesize"
+	"github.com/spf13/cobra"
+)
+
+var infoFile string
+
+// modInfo is the info command output for a remote mod release.
+type modInfo struct {
+	Name        string                         `json:"name"`
+	Repo        swizzle.Repo                   `json:"repo"`
+	Version     semver.String                  `json:"version"`
+	Description string                         `json:"description,omitempty"`
+	License     string                         `json:"license,omitempty"`
+	AgeRating   swizzle.AgeRating              `json:"ages,omitempty"`
+	Game        swizzle.Game                   `json:"game,omitempty"`
+	Dependency  map[swizzle.Repo]semver.String `json:"dependency,omitempty"`
+	Files       []modInfoFile                  `json:"files,omitempty"`
+	Archives    []modInfoArchive               `json:"archives,omitempty"`
+	Notes       string                         `json:"notes,omitempty"`
+}
+
+// modInfoFile is a release file in the info command output.
+type modInfoFile struct {
+	Name        string            `json:"name"`
+	Source      string            `json:"source,omitempty"`
+	Destination string            `json:"destination,omitempty"`
+	Size        bytesize.ByteSize `json:"size"`
+}
+
+// modInfoArchive is a BSA or BA2 archive in a staged release, with the assets
+// it overrides from other installed mods.
+type modInfoArchive struct {
+	Name       string   `json:"name"`
+	Format     string   `json:"format"`
+	Files      int      `json:"files"`
+	Overrides  []string `json:"overrides,omitempty"`
+	Overridden []string `json:"overridden,omitempty"`
+}
+
+// stagedArchives returns the archives in a mod release when it is staged for
+// the game of the installed manifest, with the assets each archive overrides
+// from other installed mods and the assets other mods override. Nothing is
+// returned when the release is not staged.
+func stagedArchives(inst *installed, repo swizzle.Repo, version semver.String) ([]modInfoArchive, error) {
+	if !inst.staging.IsStaged(repo, version) {
+		return nil, nil
+	}
+	archives, err := inst.staging.Archives(repo, version)
+	if err != nil || len(archives) == 0 {
+		return nil, err
+	}
+
+	installed := false
+	for _, m := range inst.lock.Mods {
+		if m.Repo == repo && m.Version == version {
+			installed = true
+		}
+	}
+
+	var conflicts []*swizzle.ArchiveConflict
+	if installed {
+		plan, err := inst.staging.Plan(inst.mod, inst.lock.Mods)
+		if err != nil {
+			return nil, err
+		}
+		lo, err := inst.staging.LoadOrder(inst.game)
+		if err != nil {
+			return nil, err
+		}
+		conflicts, err = plan.ArchiveConflicts(lo)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var res []modInfoArchive
+	for _, a := range archives {
+		info := modInfoArchive{Name: a.Name, Format: a.Format, Files: len(a.Files)}
+		for _, c := range conflicts {
+			for _, p := range c.Providers {
+				if p.Repo != repo || p.Archive != a.Name {
+					continue
+				}
+				if c.Winner == p {
+					info.Overrides = append(info.Overrides, c.Path)
+				} else {
+					info.Overridden = append(info.Overridden, c.Path)
+				}
+				break
+			}
+		}
+		res = append(res, info)
+	}
+	return res, nil
+}
+
+// splitRepoVersion parses a repo argument in the form owner/name@version.
+func splitRepoVersion(arg string) (swizzle.Repo, string) {
+	parts := strings.SplitN(arg, "@", 2)
+	if len(parts) == 2 && parts[1] != "" {
+		return swizzle.Repo(parts[0]), parts[1]
+	}
+	return swizzle.Repo(parts[0]), "latest"
+}
+
+// fetchManifest fetches the release manifest for a repo version, or the latest
+// release manifest if the version is "latest".
+func fetchManifest(ctx context.Context, repo swizzle.Repo, version string) (*swizzle.Manifest, error) {
+	if version == "latest" {
+		return repo.LatestManifest(ctx)
+	}
+
+	rel, err := repo.Release(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.Manifest(ctx, rel)
+}
+
+func printInfo(info *modInfo) {
+	fmt.Printf("%s (%s@%s)\n", info.Name, info.Repo, info.Version)
+	if info.Description != "" {
+		fmt.Println(info.Description)
+	}
+	fmt.Println()
+
+	if info.License != "" {
+		fmt.Println("License:", info.License)
+	}
+	if info.AgeRating.ESRB != "" {
+		fmt.Println("ESRB:", info.AgeRating.ESRB)
+	}
+	if info.Game.Executable != "" || info.Game.Version != "" {
+		fmt.Println("Game:", strings.TrimSpace(fmt.Sprintf("%s %s", info.Game.Executable, info.Game.Version)))
+	}
+
+	if len(info.Dependency) > 0 {
+		fmt.Println("\nDependencies:")
+		for k, v := range info.Dependency {
+			fmt.Printf("  %s %s\n", k, v)
+		}
+	}
+
+	if len(info.Files) > 0 {
+		fmt.Println("\nFiles:")
+		for _, f := range info.Files {
+			fmt.Printf("  %s (%s)\n", f.Name, f.Size)
+		}
+	}
+
+	if len(info.Archives) > 0 {
+		fmt.Println("\nArchives:")
+		for _, a := range info.Archives {
+			fmt.Printf("  %s (%s, %d files)\n", a.Name, a.Format, a.Files)
+			for _, p := range a.Overrides {
+				fmt.Printf("    overrides %s\n", p)
+			}
+			for _, p := range a.Overridden {
+				fmt.Printf("    overridden %s\n", p)
+			}
+		}
+	}
+
+	if info.Notes != "" {
+		fmt.Println("\nRelease notes:")
+		fmt.Println(info.Notes)
+	}
+}
+
+var infoCmd = &cobra.Command{
+	Use:   "info <repo>[@version]",
+	Short: "Show information about a remote mod release.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		repo, version := splitRepoVersion(args[0])
+		mod, err := fetchManifest(ctx, repo, version)
+		if err != nil {
+			return err
+		}
+
+		info := &modInfo{
+			Name:        mod.Name,
+			Repo:        mod.Repo,
+			Version:     mod.Version,
+			Description: mod.Description,
+			License:     mod.License,
+			AgeRating:   mod.AgeRating,
+			Game:        mod.Game,
+			Dependency:  mod.Dependency,
+			Notes:       mod.ReleaseNotes(),
+		}
+		if info.Name == "" {
+			info.Name = repo.Name()
+		}
+		for _, f := range mod.Files {
+			info.Files = append(info.Files, modInfoFile{
+				Name:        f.Name,
+				Source:      f.Source,
+				Destination: f.Destination,
+				Size:        f.Size(),
+			})
+		}
+
+		// archives are only listed for releases staged for the installed
+		// manifest
+		if inst, err := readInstalled(cmd, infoFile); err == nil {
+			info.Archives, err = stagedArchives(inst, mod.Repo, mod.Version)
+			if err != nil {
+				return err
+			}
+		}
+
+		return printResult(info, func() {
+			printInfo(info)
+		})
+	},
+}
+
+func init() {
+	infoCmd.PersistentFlags().StringVarP(&infoFile, "file", "f", defManifestFile, "Swizzle manifest file, for the archives in staged releases.")
+	rootCmd.AddCommand(infoCmd)
+}
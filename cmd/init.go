@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/afloesch/megamod/swizzle"
 	"github.com/afloesch/semver"
@@ -15,47 +17,75 @@ var (
 	modDesc      string
 	gameExe      string
 	gameVer      string
+	initVersion  string
+	initGame     string
 
-	defModName string = "Enter mod name"
-	defModDesc string = "Short mod description text."
-	defGameExe string = "Game.exe"
 	defGameVer string = ">=v0.0.0"
 )
 
-func runPrompts() error {
-	promptName := promptui.Prompt{
-		Label:   "Name",
-		Default: modName,
+func validateVersion(s string) error {
+	return swizzle.ValidateVersion(semver.String(s))
+}
+
+// configureGame offers to add a Steam game install containing the game executable
+// to the swizzle config, using the manifest file as the game default manifest.
+func configureGame(exe string, manifest string) error {
+	if exe == "" {
+		return nil
 	}
-	promptDesc := promptui.Prompt{
-		Label:   "Description",
-		Default: modDesc,
+
+	installs, err := swizzle.FindGameInstalls(exe)
+	if err != nil || len(installs) == 0 {
+		return err
 	}
-	promptGame := promptui.Prompt{
-		Label:   "Game Executable",
-		Default: gameExe,
+
+	items := []string{"Skip"}
+	for _, g := range installs {
+		items = append(items, fmt.Sprintf("%s (%s)", g.Name, g.Directory))
 	}
 
-	var err error
-	if modName == defModName {
-		modName, err = promptName.Run()
-		if err != nil {
-			return err
-		}
+	sel := promptui.Select{
+		Label: "Configure game install",
+		Items: items,
 	}
-	if modDesc == defModDesc {
-		modDesc, err = promptDesc.Run()
-		if err != nil {
-			return err
-		}
+	i, _, err := sel.Run()
+	if err != nil || i == 0 {
+		return err
 	}
-	if gameExe == defGameExe {
-		gameExe, err = promptGame.Run()
-		if err != nil {
-			return err
-		}
+	install := installs[i-1]
+
+	prompt := promptui.Prompt{
+		Label:   "Game name",
+		Default: strings.ToLower(strings.TrimSuffix(exe, filepath.Ext(exe))),
+		Validate: func(s string) error {
+			if s == "" {
+				return fmt.Errorf("game name is required")
+			}
+			return nil
+		},
+	}
+	name, err := prompt.Run()
+	if err != nil {
+		return err
+	}
+
+	path, err := filepath.Abs(manifest)
+	if err != nil {
+		return err
 	}
 
+	config.AddGame(&swizzle.GameConfig{
+		Name:       name,
+		Directory:  install.Directory,
+		Executable: exe,
+		AppID:      install.AppID,
+		Manifest:   path,
+	})
+	if err := config.WriteFile(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Game '%s' added to %s\n", name, config.Path())
 	return nil
 }
 
@@ -63,9 +93,33 @@ var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize new swizzle manifest file.",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		err := runPrompts()
-		if err != nil {
-			fmt.Println(err)
+		var err error
+		if modName, err = inputValue(cmd, "name", "Name", true, nil); err != nil {
+			return err
+		}
+		if modDesc, err = inputValue(cmd, "desc", "Description", false, nil); err != nil {
+			return err
+		}
+		// the deprecated init --game flag shadows the global --game flag, so a
+		// configured game name still selects the game
+		if cmd.Flags().Changed("game") {
+			if _, err := config.Game(initGame); err == nil {
+				gameName = initGame
+			} else if !cmd.Flags().Changed("exe") {
+				cmd.Flags().Set("exe", initGame)
+			}
+		}
+		if g := selectedGame(); g != nil && !cmd.Flags().Changed("exe") {
+			cmd.Flags().Set("exe", g.Executable)
+		}
+		if gameExe, err = inputValue(cmd, "exe", "Game Executable", false, nil); err != nil {
+			return err
+		}
+		if cmd.Flags().Changed("version") && !cmd.Flags().Changed("game-version") {
+			cmd.Flags().Set("game-version", initVersion)
+		}
+		if gameVer, err = inputValue(cmd, "game-version", "Game Version", false, validateVersion); err != nil {
+			return err
 		}
 
 		m := swizzle.New()
@@ -74,22 +128,38 @@ var initCmd = &cobra.Command{
 		m.Game.Executable = gameExe
 		m.Game.Version = semver.String(gameVer)
 
+		manifestFile = manifestPath(cmd, manifestFile)
 		err = m.WriteFile(manifestFile)
 		if err != nil {
-			fmt.Println(err)
+			return err
 		}
 
-		fmt.Println("Manifest created:", manifestFile)
-		return nil
+		if selectedGame() == nil && interactive() {
+			if err := configureGame(gameExe, manifestFile); err != nil {
+				return err
+			}
+		}
+
+		res := struct {
+			File     string            `json:"file"`
+			Manifest *swizzle.Manifest `json:"manifest"`
+		}{manifestFile, m}
+		return printResult(res, func() {
+			fmt.Println("Manifest created:", manifestFile)
+		})
 	},
 }
 
 func init() {
-	initCmd.PersistentFlags().StringVarP(&manifestFile, "file", "f", "swizzle.yml", "Swizzle manifest file.")
-	initCmd.PersistentFlags().StringVarP(&modName, "name", "n", defModName, "Mod name.")
-	initCmd.PersistentFlags().StringVarP(&modDesc, "desc", "d", defModDesc, "Mod short description text.")
-	initCmd.PersistentFlags().StringVarP(&gameExe, "game", "g", defGameExe, "The game executable the mod is for.")
-	initCmd.PersistentFlags().StringVarP(&gameVer, "version", "v", defGameVer, "The game verion this mod is for. Defaults to all versions.")
+	initCmd.PersistentFlags().StringVarP(&manifestFile, "file", "f", defManifestFile, "Swizzle manifest file.")
+	initCmd.PersistentFlags().StringVarP(&modName, "name", "n", "", "Mod name.")
+	initCmd.PersistentFlags().StringVarP(&modDesc, "desc", "d", "", "Mod short description text.")
+	initCmd.PersistentFlags().StringVarP(&gameExe, "exe", "e", "", "The game executable the mod is for.")
+	initCmd.PersistentFlags().StringVarP(&initGame, "game", "g", "", "The game executable the mod is for, or a configured game name.")
+	initCmd.PersistentFlags().MarkDeprecated("game", "use --exe for the game executable")
+	initCmd.PersistentFlags().StringVarP(&gameVer, "game-version", "v", defGameVer, "The game verion this mod is for. Defaults to all versions.")
+	initCmd.PersistentFlags().StringVar(&initVersion, "version", defGameVer, "The game verion this mod is for.")
+	initCmd.PersistentFlags().MarkDeprecated("version", "use --game-version instead")
 
 	rootCmd.AddCommand(initCmd)
 }
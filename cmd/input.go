@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/chzyer/readline"
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+)
+
+// envPrefix is the prefix for all swizzle environment variables.
+const envPrefix string = "SWIZZLE_"
+
+var noInput bool
+
+// envName returns the environment variable name for a flag.
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// interactive checks whether prompts may be shown. Prompts are disabled by
+// the --no-input flag, the SWIZZLE_NO_INPUT environment variable, JSON output,
+// or when stdin is not a terminal.
+func interactive() bool {
+	if noInput || isJSON() {
+		return false
+	}
+
+	if v, ok := os.LookupEnv(envName("no-input")); ok {
+		if b, err := strconv.ParseBool(v); err != nil || b {
+			return false
+		}
+	}
+
+	return readline.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// flagValue returns the value of a string flag and whether it was set. Flags set
+// on the command line take precedence over environment variables, for example
+// SWIZZLE_NAME for the --name flag.
+func flagValue(cmd *cobra.Command, name string) (string, bool) {
+	if cmd.Flags().Changed(name) {
+		v, _ := cmd.Flags().GetString(name)
+		return v, true
+	}
+
+	if v, ok := os.LookupEnv(envName(name)); ok {
+		return v, true
+	}
+
+	v, _ := cmd.Flags().GetString(name)
+	return v, false
+}
+
+// inputValue returns a flag value, prompting for it when the flag is unset and
+// the session is interactive. The value is validated in all cases.
+func inputValue(
+	cmd *cobra.Command,
+	name string,
+	label string,
+	required bool,
+	validate func(string) error,
+) (string, error) {
+	v, set := flagValue(cmd, name)
+	if !set && interactive() {
+		prompt := promptui.Prompt{
+			Label:   label,
+			Default: v,
+			Validate: func(s string) error {
+				if required && s == "" {
+					return fmt.Errorf("%s is required", strings.ToLower(label))
+				}
+				if validate != nil && s != "" {
+					return validate(s)
+				}
+				return nil
+			},
+		}
+
+		var err error
+		v, err = prompt.Run()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if required && v == "" {
+		return "", swizzle.NewError(
+			swizzle.ErrCodeInvalidInput,
+			"",
+			"",
+			fmt.Errorf("missing required value: set --%s or %s", name, envName(name)),
+		)
+	}
+
+	if validate != nil && v != "" {
+		if err := validate(v); err != nil {
+			return "", err
+		}
+	}
+
+	return v, nil
+}
@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/inhies/go-bytesize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	installFile     string
+	installMethod   string
+	installRestage  bool
+	installDryRun   bool
+	installDownload bool
+	installBundle   string
+	installForce    bool
+)
+
+func printInstallPlan(p *swizzle.InstallPlan) {
+	fmt.Println("Mods:")
+	for _, m := range p.Mods {
+		fmt.Printf("  %s %s\n", m.Repo, m.Version)
+	}
+
+	if len(p.Assets) > 0 {
+		fmt.Println("\nDownloads:")
+		for _, a := range p.Assets {
+			cached := ""
+			if a.Cached {
+				cached = " (cached)"
+			}
+			if a.Fomod {
+				cached += " (FOMOD)"
+			}
+			fmt.Printf("  %s %s %s %s%s\n", a.Repo, a.Version, a.Name, bytesize.New(float64(a.Size)), cached)
+		}
+	}
+
+	counts := map[swizzle.FileAction]int{}
+	if len(p.Files) > 0 {
+		fmt.Println("\nFiles:")
+		for _, f := range p.Files {
+			counts[f.Action]++
+			fmt.Printf("  %-9s %s:%s\n", f.Action, f.Root, f.Path)
+		}
+	}
+
+	if len(p.INI) > 0 {
+		fmt.Println("\nINI:")
+		for _, set := range p.INI {
+			fmt.Printf("  %s [%s] %s=%s (%s)\n", set.File, set.Section, set.Key, set.Value, iniSetter(set.Repo))
+		}
+	}
+
+	if len(p.Conflicts) > 0 {
+		fmt.Printf("\n%d file conflicts, see 'swizzle conflicts' after install.\n", len(p.Conflicts))
+	}
+
+	if len(p.INIConflicts) > 0 {
+		fmt.Println()
+		printINIConflicts(p.INIConflicts)
+	}
+
+	for _, a := range p.Unlisted {
+		fmt.Printf("\nWarning: %s %s is not downloaded, its files are not listed.\n", a.Repo, a.Name)
+	}
+
+	fmt.Printf(
+		"\n%d files created, %d overwritten, %d deleted\nDownload: %s\nDisk usage: %s\n",
+		counts[swizzle.CreateFile],
+		counts[swizzle.OverwriteFile],
+		counts[swizzle.DeleteFile],
+		bytesize.New(float64(p.DownloadSize)),
+		bytesize.New(float64(p.DiskSize)),
+	)
+}
+
+// installGraph stages every mod in the graph which is not yet staged, deploys
+// the graph to the game and writes the load order in one transaction, so any
+// error or interrupt restores the previously staged mods, deployment and load
+// order. Only the mods in the active profile are deployed. Masters missing for
+// deployed plugins are returned as warnings.
+func installGraph(
+	ctx context.Context,
+	staging *swizzle.Staging,
+	game *swizzle.GameConfig,
+	mod *swizzle.Manifest,
+	graph *swizzle.Graph,
+) (*deployResult, error) {
+	tx, err := staging.Begin(game)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := func() (*deployResult, error) {
+		opts := stageOptions(staging, game)
+		for _, n := range graph.InstallOrder() {
+			m := n.Manifest()
+			if staging.IsStaged(m.Repo, m.Version) && !installRestage {
+				continue
+			}
+			if err := tx.Stage(ctx, m, opts...); err != nil {
+				return nil, err
+			}
+		}
+
+		pm, mods, err := applyActiveProfile(staging, mod, graph.Lock().Mods, graph)
+		if err != nil {
+			return nil, err
+		}
+		plan, err := staging.Plan(pm, mods)
+		if err != nil {
+			return nil, err
+		}
+		missing, unreadable, err := staging.MissingMasters(game, plan)
+		if err != nil {
+			return nil, err
+		}
+
+		d, err := tx.Deploy(ctx, plan, swizzle.DeployMethod(installMethod))
+		if err != nil {
+			return nil, err
+		}
+		lo, err := tx.WriteLoadOrder()
+		if err != nil {
+			return nil, err
+		}
+
+		return &deployResult{
+			Deployment:        d,
+			MissingMasters:    missing,
+			UnreadablePlugins: unreadable,
+			INIConflicts:      plan.INIConflicts,
+			LoadOrder:         lo,
+		}, nil
+	}()
+	if err != nil {
+		return nil, rollback(tx, err)
+	}
+	return res, tx.Commit()
+}
+
+var installCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Download, stage and deploy all mods in a manifest to the game.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := interruptContext()
+		defer stop()
+
+		file := manifestPath(cmd, installFile)
+		var bundle *swizzle.Bundle
+		var mod *swizzle.Manifest
+		var err error
+		if installBundle != "" {
+			if bundle, err = swizzle.OpenBundle(installBundle); err != nil {
+				return err
+			}
+			mod = bundle.Manifest
+			if _, err := os.Stat(file); err == nil && !installForce && !installDryRun {
+				return swizzle.NewError(swizzle.ErrCodeInvalidInput, "", "", fmt.Errorf("manifest '%s' already exists, use --force to replace it", file))
+			}
+		} else if mod, err = swizzle.New().ReadFile(file); err != nil {
+			return err
+		}
+
+		game, err := gameForManifest(mod)
+		if err != nil {
+			return err
+		}
+
+		// bundled release files are copied to the cache, so nothing is
+		// downloaded
+		var graph *swizzle.Graph
+		if bundle != nil {
+			if err := bundle.Extract(game.CacheDir()); err != nil {
+				return err
+			}
+			graph, err = bundle.Graph()
+		} else {
+			graph, err = mod.Graph(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		staging := swizzle.NewStaging(game.StagingDir())
+		if installDryRun {
+			var fetch func(*swizzle.Manifest, *swizzle.ReleaseFile) error
+			if installDownload {
+				fetch = func(m *swizzle.Manifest, f *swizzle.ReleaseFile) error {
+					return downloadFile(ctx, m, f, game.CacheDir())
+				}
+			}
+
+			method := swizzle.DeployMethod(installMethod)
+			plan, err := staging.InstallPlan(game, mod, graph, game.CacheDir(), method, fetch)
+			if err != nil {
+				return err
+			}
+
+			return printResult(plan, func() {
+				printInstallPlan(plan)
+			})
+		}
+
+		for _, n := range graph.InstallOrder() {
+			m := n.Manifest()
+			if staging.IsStaged(m.Repo, m.Version) && !installRestage {
+				continue
+			}
+			for _, f := range m.Files {
+				if err := downloadFile(ctx, m, f, game.CacheDir()); err != nil {
+					return err
+				}
+			}
+		}
+
+		res, err := installGraph(ctx, staging, game, mod, graph)
+		if err != nil {
+			return err
+		}
+
+		if bundle != nil {
+			if err := mod.WriteFile(file); err != nil {
+				return err
+			}
+		}
+		lock := graph.Lock()
+		if err := lock.WriteFile(swizzle.LockPath(file)); err != nil {
+			return err
+		}
+
+		return printResult(res, func() {
+			for _, m := range res.Mods {
+				fmt.Printf("Installed %s %s\n", m.Repo, m.Version)
+			}
+			fmt.Printf("%d files deployed to %s\n", len(res.Files), game.GameDir())
+			printMissingMasters(res.MissingMasters)
+			printUnreadablePlugins(res.UnreadablePlugins)
+			printINIConflicts(res.INIConflicts)
+			printLoadOrder(res.LoadOrder)
+		})
+	},
+}
+
+func init() {
+	installCmd.PersistentFlags().StringVarP(&installFile, "file", "f", defManifestFile, "Swizzle manifest file.")
+	installCmd.PersistentFlags().StringVarP(&installMethod, "method", "m", string(swizzle.HardlinkDeploy), "Deploy method, one of hardlink, symlink, or copy.")
+	installCmd.PersistentFlags().BoolVar(&installRestage, "restage", false, "Extract mods to the staging directory even when already staged.")
+	installCmd.PersistentFlags().BoolVar(&installDryRun, "dry-run", false, "Print the install plan without staging or deploying any files. Only release files already in the cache are listed.")
+	installCmd.PersistentFlags().BoolVar(&installDownload, "download", false, "With --dry-run, download release files missing from the cache to list their contents.")
+	installCmd.PersistentFlags().StringVar(&installBundle, "from-bundle", "", "Install the manifest in a bundle created with 'swizzle bundle create' without network access. The bundle manifest and lock are written to the manifest file location.")
+	installCmd.PersistentFlags().BoolVar(&installForce, "force", false, "With --from-bundle, replace an existing manifest file.")
+	rootCmd.AddCommand(installCmd)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/afloesch/megamod/swizzle"
+)
+
+const (
+	textOutput string = "text"
+	jsonOutput string = "json"
+)
+
+var outputFormat string
+
+// cmdError is the structured error output for a failed command.
+type cmdError struct {
+	Code    swizzle.ErrorCode `json:"code"`
+	Message string            `json:"message"`
+	Repo    swizzle.Repo      `json:"repo,omitempty"`
+	Version string            `json:"version,omitempty"`
+}
+
+// resultError is a command failure reported after the command result was
+// printed, so JSON output stays a single document.
+type resultError struct {
+	err error
+}
+
+func (e *resultError) Error() string {
+	return e.err.Error()
+}
+
+func (e *resultError) Unwrap() error {
+	return e.err
+}
+
+// isJSON checks whether commands should write JSON output.
+func isJSON() bool {
+	return outputFormat == jsonOutput
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printResult writes the command result to stdout as JSON when JSON output is
+// enabled, or otherwise calls text to print the result for humans.
+func printResult(v interface{}, text func()) error {
+	if isJSON() {
+		return printJSON(v)
+	}
+	text()
+	return nil
+}
+
+// printError writes a command error to stdout as JSON when JSON output is
+// enabled, or otherwise to stderr as text. Errors for a printed result are
+// always written to stderr.
+func printError(err error) {
+	var rerr *resultError
+	if !isJSON() || errors.As(err, &rerr) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return
+	}
+
+	e := cmdError{
+		Code:    swizzle.ErrorCodeOf(err),
+		Message: err.Error(),
+	}
+
+	var serr *swizzle.Error
+	if errors.As(err, &serr) {
+		e.Repo = serr.Repo
+		e.Version = serr.Version
+	}
+
+	printJSON(struct {
+		Error cmdError `json:"error"`
+	}{e})
+}
+
+// validateOutput checks the --output flag value.
+func validateOutput() error {
+	switch outputFormat {
+	case textOutput, jsonOutput:
+		return nil
+	}
+	return fmt.Errorf("unknown output format '%s'", outputFormat)
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/inhies/go-bytesize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	packFile        string
+	packName        string
+	packOutDir      string
+	packInclude     []string
+	packExclude     []string
+	packDestination string
+	packRoot        string
+)
+
+var packCmd = &cobra.Command{
+	Use:   "pack <dir>",
+	Short: "Create a release archive from a mod folder and add it to the manifest files.",
+	Long: `Create a zip or 7z release archive from the files in a mod folder, and add
+the archive to the manifest release files with its size and hash. An existing
+release file with the same name is updated. The archive format is chosen by
+the archive name extension, and 7z archives require the 7-Zip command line
+program.
+
+Include and exclude patterns without a slash match any file or directory name,
+for example '*.psd', and patterns with a slash match the path in the folder,
+for example 'Data/Source/*'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := manifestPath(cmd, packFile)
+		mod, err := swizzle.New().ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		name := packName
+		if name == "" {
+			abs, err := filepath.Abs(args[0])
+			if err != nil {
+				return err
+			}
+			name = filepath.Base(abs) + string(swizzle.ZipFileExtension)
+		}
+		if filepath.Base(name) != name {
+			return swizzle.NewError(swizzle.ErrCodeInvalidInput, "", "", fmt.Errorf("archive name '%s' must not include a directory, use --out-dir", name))
+		}
+		if cmd.Flags().Changed("root") {
+			switch swizzle.InstallRoot(packRoot) {
+			case swizzle.GameRoot, swizzle.DocumentsRoot, swizzle.AppDataRoot:
+			default:
+				return swizzle.NewError(swizzle.ErrCodeInvalidInput, "", "", fmt.Errorf("unknown install root '%s', expected game, documents, or appdata", packRoot))
+			}
+		}
+
+		res, err := swizzle.Pack(args[0], filepath.Join(packOutDir, name), swizzle.PackOptions{
+			Include: packInclude,
+			Exclude: packExclude,
+		})
+		if err != nil {
+			return err
+		}
+
+		var rf *swizzle.ReleaseFile
+		for _, f := range mod.Files {
+			if f.Name == name {
+				rf = f
+			}
+		}
+		if rf == nil {
+			rf = &swizzle.ReleaseFile{Name: name}
+			mod.Files = append(mod.Files, rf)
+		}
+		rf.Bytes = res.Size
+		rf.Hash = res.Hash
+		if cmd.Flags().Changed("destination") {
+			rf.Destination = packDestination
+		}
+		if cmd.Flags().Changed("root") {
+			rf.Root = swizzle.InstallRoot(packRoot)
+		}
+
+		if err := mod.WriteFile(file); err != nil {
+			return err
+		}
+
+		out := struct {
+			*swizzle.PackResult
+			File *swizzle.ReleaseFile `json:"file"`
+		}{res, rf}
+		return printResult(out, func() {
+			fmt.Printf("Packed %d files into %s (%s)\n", len(res.Files), res.Archive, bytesize.New(float64(res.Size)))
+			fmt.Printf("%s: %s\n", rf.Name, rf.Hash)
+		})
+	},
+}
+
+func init() {
+	packCmd.PersistentFlags().StringVarP(&packFile, "file", "f", defManifestFile, "Swizzle manifest file.")
+	packCmd.PersistentFlags().StringVarP(&packName, "name", "n", "", "Release archive file name, ending in .zip or .7z. Defaults to the folder name with a .zip extension.")
+	packCmd.PersistentFlags().StringVar(&packOutDir, "out-dir", ".", "Directory to write the release archive to.")
+	packCmd.PersistentFlags().StringArrayVarP(&packInclude, "include", "i", nil, "Pattern for files to pack. Defaults to every file.")
+	packCmd.PersistentFlags().StringArrayVarP(&packExclude, "exclude", "x", nil, "Pattern for files to leave out of the archive.")
+	packCmd.PersistentFlags().StringVarP(&packDestination, "destination", "d", "", "Release file destination folder, relative to the install root.")
+	packCmd.PersistentFlags().StringVarP(&packRoot, "root", "r", "", "Release file install root, one of game, documents, or appdata.")
+	rootCmd.AddCommand(packCmd)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pluginsFile  string
+	pluginsWrite bool
+)
+
+var pluginsCmd = &cobra.Command{
+	Use:   "plugins",
+	Short: "Print the sorted plugin load order for the game.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		game, staging, err := manifestGame(cmd, pluginsFile)
+		if err != nil {
+			return err
+		}
+
+		var lo *swizzle.LoadOrder
+		if pluginsWrite {
+			lo, err = staging.WriteLoadOrder(game)
+		} else {
+			lo, err = staging.LoadOrder(game)
+		}
+		if err != nil {
+			return err
+		}
+
+		return printResult(lo, func() {
+			for i, p := range lo.Plugins {
+				enabled := " "
+				if p.Enabled {
+					enabled = "*"
+				}
+				source := "base game"
+				if p.Repo != "" {
+					source = p.Repo.String()
+				}
+				fmt.Printf("%3d %s%s\t%s\n", i, enabled, p.Name, source)
+			}
+			if pluginsWrite {
+				printLoadOrder(lo)
+			}
+		})
+	},
+}
+
+func init() {
+	pluginsCmd.PersistentFlags().StringVarP(&pluginsFile, "file", "f", defManifestFile, "Swizzle manifest file.")
+	pluginsCmd.PersistentFlags().BoolVarP(&pluginsWrite, "write", "w", false, "Write plugins.txt and loadorder.txt for the sorted load order.")
+	rootCmd.AddCommand(pluginsCmd)
+}
@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/spf13/cobra"
+)
+
+var (
+	profileFile string
+	profileMods []string
+	profileINI  []string
+	profileFrom string
+)
+
+// applyActiveProfile limits the manifest and locked mods to the active
+// profile. The manifest and mods are returned unchanged when no profile is in
+// use. The graph may be nil.
+func applyActiveProfile(staging *swizzle.Staging, mod *swizzle.Manifest, mods []*swizzle.LockedMod, graph *swizzle.Graph) (*swizzle.Manifest, []*swizzle.LockedMod, error) {
+	p, err := staging.ActiveProfile()
+	if err != nil || p == nil {
+		return mod, mods, err
+	}
+	return p.Apply(staging, mod, mods, graph)
+}
+
+// parseINITweak parses an INI tweak flag in the form
+// [root:]file:section:key=value.
+func parseINITweak(s string) (*swizzle.INITweak, error) {
+	kv := strings.SplitN(s, "=", 2)
+	parts := strings.Split(kv[0], ":")
+	if len(kv) != 2 || len(parts) < 3 || len(parts) > 4 {
+		return nil, fmt.Errorf("invalid INI tweak '%s', expected [root:]file:section:key=value", s)
+	}
+
+	t := &swizzle.INITweak{Value: kv[1]}
+	if len(parts) == 4 {
+		t.Root = swizzle.InstallRoot(parts[0])
+		parts = parts[1:]
+	}
+	t.File, t.Section, t.Key = parts[0], parts[1], parts[2]
+	return t, nil
+}
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Switch between named sets of enabled mods.",
+}
+
+var profileCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a profile from a subset of the manifest dependencies.",
+	Long: `Create a profile from a subset of the manifest dependencies. All dependencies
+are enabled unless mods are listed with --mod. The current plugin load order
+is saved to the profile.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mod, err := swizzle.New().ReadFile(manifestPath(cmd, profileFile))
+		if err != nil {
+			return err
+		}
+		game, err := gameForManifest(mod)
+		if err != nil {
+			return err
+		}
+		staging := swizzle.NewStaging(game.StagingDir())
+
+		p := &swizzle.Profile{Name: args[0]}
+		if profileFrom != "" {
+			from, err := staging.Profile(profileFrom)
+			if err != nil {
+				return err
+			}
+			p.Mods = append(p.Mods, from.Mods...)
+			p.INI = append(p.INI, from.INI...)
+		}
+		for _, m := range profileMods {
+			p.Mods = append(p.Mods, swizzle.Repo(m))
+		}
+		if profileFrom == "" && len(profileMods) == 0 {
+			for repo := range mod.Dependency {
+				p.Mods = append(p.Mods, repo)
+			}
+		}
+		for _, s := range profileINI {
+			t, err := parseINITweak(s)
+			if err != nil {
+				return err
+			}
+			p.INI = append(p.INI, t)
+		}
+
+		if err := staging.CreateProfile(mod, p); err != nil {
+			return err
+		}
+		if err := staging.SaveProfileLoadOrder(game, p); err != nil {
+			return err
+		}
+
+		return printResult(p, func() {
+			fmt.Printf("Created profile %s with %d mods\n", p.Name, len(p.Mods))
+		})
+	},
+}
+
+var profileUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Deploy the mods, load order and INI tweaks of a profile to the game.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := interruptContext()
+		defer stop()
+
+		inst, err := readInstalled(cmd, profileFile)
+		if err != nil {
+			return err
+		}
+
+		p, err := inst.staging.Profile(args[0])
+		if err != nil {
+			return err
+		}
+		mod, mods, err := p.Apply(inst.staging, inst.mod, inst.lock.Mods, nil)
+		if err != nil {
+			return err
+		}
+
+		plan, err := inst.staging.Plan(mod, mods)
+		if err != nil {
+			return err
+		}
+		missing, unreadable, err := inst.staging.MissingMasters(inst.game, plan)
+		if err != nil {
+			return err
+		}
+
+		tx, err := inst.staging.Begin(inst.game)
+		if err != nil {
+			return err
+		}
+		d, err := tx.Deploy(ctx, plan, swizzle.DeployMethod(deployMethod))
+		if err != nil {
+			return rollback(tx, err)
+		}
+		lo, err := tx.UseProfile(p)
+		if err != nil {
+			return rollback(tx, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		return printResult(&deployResult{d, missing, unreadable, plan.INIConflicts, lo}, func() {
+			fmt.Printf("Using profile %s: %d mods, %d files deployed to %s\n", p.Name, len(d.Mods), len(d.Files), inst.game.GameDir())
+			printMissingMasters(missing)
+			printUnreadablePlugins(unreadable)
+			printINIConflicts(plan.INIConflicts)
+			printLoadOrder(lo)
+		})
+	},
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List profiles for the game.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, staging, err := manifestGame(cmd, profileFile)
+		if err != nil {
+			return err
+		}
+
+		profiles, err := staging.Profiles()
+		if err != nil {
+			return err
+		}
+		active, err := staging.ActiveProfile()
+		if err != nil {
+			return err
+		}
+
+		type profileInfo struct {
+			Name    string `json:"name"`
+			Active  bool   `json:"active"`
+			Created string `json:"created"`
+			Mods    int    `json:"mods"`
+			INI     int    `json:"ini"`
+		}
+		res := []profileInfo{}
+		for _, p := range profiles {
+			res = append(res, profileInfo{
+				Name:    p.Name,
+				Active:  active != nil && active.Name == p.Name,
+				Created: p.Created.Format("2006-01-02 15:04:05Z"),
+				Mods:    len(p.Mods),
+				INI:     len(p.INI),
+			})
+		}
+
+		return printResult(res, func() {
+			if len(res) == 0 {
+				fmt.Println("No profiles")
+			}
+			for _, p := range res {
+				marker := " "
+				if p.Active {
+					marker = "*"
+				}
+				fmt.Printf("%s %s\t%s\t%d mods\t%d INI tweaks\n", marker, p.Name, p.Created, p.Mods, p.INI)
+			}
+		})
+	},
+}
+
+var profileDiffCmd = &cobra.Command{
+	Use:   "diff <from> [to]",
+	Short: "Show the mods, INI tweaks and plugins which differ between two profiles.",
+	Long: `Show the mods, INI tweaks and enabled plugins which differ between two
+profiles. The active profile is compared when only one profile is given.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, staging, err := manifestGame(cmd, profileFile)
+		if err != nil {
+			return err
+		}
+
+		from, err := staging.Profile(args[0])
+		if err != nil {
+			return err
+		}
+		var to *swizzle.Profile
+		if len(args) == 2 {
+			to, err = staging.Profile(args[1])
+		} else {
+			to, err = staging.ActiveProfile()
+			if err == nil && to == nil {
+				err = fmt.Errorf("no profile is in use, name a second profile to compare")
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		diff := from.Diff(to)
+		return printResult(diff, func() {
+			fmt.Printf("%s -> %s\n", diff.From, diff.To)
+			for _, r := range diff.Added {
+				fmt.Printf("+ %s\n", r)
+			}
+			for _, r := range diff.Removed {
+				fmt.Printf("- %s\n", r)
+			}
+			value := func(v *string) string {
+				if v == nil {
+					return "(unset)"
+				}
+				return *v
+			}
+			for _, i := range diff.INI {
+				fmt.Printf("~ %s [%s] %s: %s -> %s\n", i.File, i.Section, i.Key, value(i.From), value(i.To))
+			}
+			for _, p := range diff.Plugins {
+				state := "disabled"
+				if p.To {
+					state = "enabled"
+				}
+				fmt.Printf("~ %s %s\n", p.Name, state)
+			}
+			if len(diff.Added)+len(diff.Removed)+len(diff.INI)+len(diff.Plugins) == 0 {
+				fmt.Println("No differences")
+			}
+		})
+	},
+}
+
+func init() {
+	profileCmd.PersistentFlags().StringVarP(&profileFile, "file", "f", defManifestFile, "Swizzle manifest file.")
+	profileCreateCmd.PersistentFlags().StringSliceVarP(&profileMods, "mod", "m", nil, "Manifest dependency to enable in the profile. Defaults to all dependencies.")
+	profileCreateCmd.PersistentFlags().StringArrayVar(&profileINI, "ini", nil, "INI tweak for the profile, in the form [root:]file:section:key=value.")
+	profileCreateCmd.PersistentFlags().StringVar(&profileFrom, "from", "", "Existing profile to copy the mods and INI tweaks from.")
+	profileUseCmd.PersistentFlags().StringVarP(&deployMethod, "method", "m", string(swizzle.HardlinkDeploy), "Deploy method, one of hardlink, symlink, or copy.")
+	profileCmd.AddCommand(profileCreateCmd, profileUseCmd, profileListCmd, profileDiffCmd)
+	rootCmd.AddCommand(profileCmd)
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/inhies/go-bytesize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	publishFile       string
+	publishDir        string
+	publishTarget     string
+	publishNotes      string
+	publishPrerelease bool
+	publishDraft      bool
+)
+
+var publishCmd = &cobra.Command{
+	Use:   "publish",
+	Short: "Create a GitHub release for the manifest version with swiz.zle and the release files.",
+	Long: `Create a GitHub release in the manifest repo, tagged with the manifest version,
+and upload the manifest as swiz.zle and every release file as release assets.
+The release is only published once every asset name matches a release file in
+the manifest, and is removed if any upload fails. Publishing requires a GitHub
+token with write access to the repo.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := interruptContext()
+		defer stop()
+
+		mod, err := swizzle.New().ReadFile(manifestPath(cmd, publishFile))
+		if err != nil {
+			return err
+		}
+
+		rel, err := mod.Publish(ctx, swizzle.PublishOptions{
+			Dir:        publishDir,
+			Target:     publishTarget,
+			Notes:      publishNotes,
+			Prerelease: publishPrerelease,
+			Draft:      publishDraft,
+		})
+		if err != nil {
+			return err
+		}
+
+		return printResult(rel, func() {
+			for _, a := range rel.Assets {
+				fmt.Printf("Uploaded %s (%s)\n", a.Name, bytesize.New(float64(a.Size)))
+			}
+			state := "Published"
+			if rel.Draft {
+				state = "Created draft"
+			}
+			fmt.Printf("%s %s %s: %s\n", state, rel.Repo, rel.Version, rel.URL)
+		})
+	},
+}
+
+func init() {
+	publishCmd.PersistentFlags().StringVarP(&publishFile, "file", "f", defManifestFile, "Swizzle manifest file.")
+	publishCmd.PersistentFlags().StringVar(&publishDir, "dir", ".", "Directory containing the release files.")
+	publishCmd.PersistentFlags().StringVar(&publishTarget, "target", "", "Branch or commit to create the release tag from. Defaults to the repo default branch.")
+	publishCmd.PersistentFlags().StringVar(&publishNotes, "notes", "", "Release notes.")
+	publishCmd.PersistentFlags().BoolVar(&publishPrerelease, "prerelease", false, "Mark the release as a pre-release.")
+	publishCmd.PersistentFlags().BoolVar(&publishDraft, "draft", false, "Leave the release as a draft after uploading the assets.")
+	rootCmd.AddCommand(publishCmd)
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/spf13/cobra"
+)
+
+var snapshotFile string
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Record and restore the state of the game directory.",
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Record the game files and deployed mods as a named snapshot.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		game, staging, err := manifestGame(cmd, snapshotFile)
+		if err != nil {
+			return err
+		}
+
+		snap, err := staging.CreateSnapshot(game, args[0])
+		if err != nil {
+			return err
+		}
+
+		return printResult(snap, func() {
+			fmt.Printf("Created snapshot %s with %d files and %d mods\n", snap.Name, len(snap.Files), len(snap.Deployment.Mods))
+		})
+	},
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List snapshots for the game.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, staging, err := manifestGame(cmd, snapshotFile)
+		if err != nil {
+			return err
+		}
+
+		snaps, err := staging.Snapshots()
+		if err != nil {
+			return err
+		}
+
+		type snapshotInfo struct {
+			Name    string `json:"name"`
+			Created string `json:"created"`
+			Files   int    `json:"files"`
+			Mods    int    `json:"mods"`
+		}
+		res := []snapshotInfo{}
+		for _, s := range snaps {
+			res = append(res, snapshotInfo{
+				Name:    s.Name,
+				Created: s.Created.Format("2006-01-02 15:04:05Z"),
+				Files:   len(s.Files),
+				Mods:    len(s.Deployment.Mods),
+			})
+		}
+
+		return printResult(res, func() {
+			if len(res) == 0 {
+				fmt.Println("No snapshots")
+			}
+			for _, s := range res {
+				fmt.Printf("%s\t%s\t%d files\t%d mods\n", s.Name, s.Created, s.Files, s.Mods)
+			}
+		})
+	},
+}
+
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <name>",
+	Short: "Return the game to the state recorded by a snapshot.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := interruptContext()
+		defer stop()
+
+		game, staging, err := manifestGame(cmd, snapshotFile)
+		if err != nil {
+			return err
+		}
+
+		res, err := staging.RestoreSnapshot(ctx, game, args[0])
+		if err != nil {
+			return err
+		}
+
+		// keep the lock file in sync with the restored mods
+		lock := &swizzle.Lock{Mods: res.Deployment.Mods}
+		if err := lock.WriteFile(swizzle.LockPath(manifestPath(cmd, snapshotFile))); err != nil {
+			return err
+		}
+
+		return printResult(res, func() {
+			for _, p := range res.Restored {
+				fmt.Printf("restored %s:%s\n", p.Root, p.Path)
+			}
+			for _, p := range res.Modified {
+				fmt.Printf("Warning: %s:%s changed since the snapshot\n", p.Root, p.Path)
+			}
+			for _, p := range res.Missing {
+				fmt.Printf("Warning: %s:%s removed since the snapshot\n", p.Root, p.Path)
+			}
+			fmt.Printf("Restored snapshot %s, %d files deployed to %s\n", res.Snapshot.Name, len(res.Deployment.Files), game.GameDir())
+		})
+	},
+}
+
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a snapshot.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, staging, err := manifestGame(cmd, snapshotFile)
+		if err != nil {
+			return err
+		}
+
+		snap, err := staging.DeleteSnapshot(args[0])
+		if err != nil {
+			return err
+		}
+
+		return printResult(snap, func() {
+			fmt.Printf("Deleted snapshot %s\n", snap.Name)
+		})
+	},
+}
+
+func init() {
+	snapshotCmd.PersistentFlags().StringVarP(&snapshotFile, "file", "f", defManifestFile, "Swizzle manifest file.")
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotRestoreCmd)
+	snapshotCmd.AddCommand(snapshotDeleteCmd)
+	rootCmd.AddCommand(snapshotCmd)
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/afloesch/megamod/swizzle"
+	"github.com/spf13/cobra"
+)
+
+var verifyFile string
+
+// printVerification prints the missing, modified and extra files for each
+// mod.
+func printVerification(v *swizzle.Verification) {
+	for _, m := range v.Mods {
+		status := "ok"
+		if !m.OK() {
+			status = fmt.Sprintf("%d missing, %d modified", len(m.Missing), len(m.Modified))
+		}
+		fmt.Printf("%s %s: %d files, %s\n", m.Repo, m.Version, m.Files, status)
+
+		for _, p := range m.Missing {
+			fmt.Printf("  missing  %s:%s\n", p.Root, p.Path)
+		}
+		for _, p := range m.Modified {
+			fmt.Printf("  modified %s:%s\n", p.Root, p.Path)
+		}
+		for _, p := range m.Extra {
+			fmt.Printf("  extra    %s:%s\n", p.Root, p.Path)
+		}
+	}
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check every installed file against the hash recorded at install time.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		game, staging, err := manifestGame(cmd, verifyFile)
+		if err != nil {
+			return err
+		}
+
+		v, err := staging.Verify(game)
+		if err != nil {
+			return err
+		}
+
+		res := struct {
+			OK bool `json:"ok"`
+			*swizzle.Verification
+		}{v.OK(), v}
+		if err := printResult(res, func() { printVerification(v) }); err != nil {
+			return err
+		}
+		if !v.OK() {
+			return &resultError{fmt.Errorf("installed files are missing or modified, run 'swizzle repair'")}
+		}
+		return nil
+	},
+}
+
+var repairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Restore missing or modified installed files from the cached release files.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		game, staging, err := manifestGame(cmd, verifyFile)
+		if err != nil {
+			return err
+		}
+
+		v, repaired, err := staging.Repair(game)
+		if err != nil {
+			return err
+		}
+
+		res := struct {
+			Verification *swizzle.Verification   `json:"verification"`
+			Repaired     []*swizzle.DeployedFile `json:"repaired"`
+		}{v, repaired}
+		return printResult(res, func() {
+			for _, f := range repaired {
+				fmt.Printf("repaired %s:%s (%s)\n", f.Root, f.Path, f.Repo)
+			}
+			fmt.Printf("%d files repaired\n", len(repaired))
+		})
+	},
+}
+
+func init() {
+	verifyCmd.PersistentFlags().StringVarP(&verifyFile, "file", "f", defManifestFile, "Swizzle manifest file.")
+	repairCmd.PersistentFlags().StringVarP(&verifyFile, "file", "f", defManifestFile, "Swizzle manifest file.")
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(repairCmd)
+}
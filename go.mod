@@ -5,9 +5,11 @@ go 1.18
 require (
 	github.com/afloesch/semver v1.0.1
 	github.com/bodgit/sevenzip v1.2.2
+	github.com/chzyer/readline v1.5.0
 	github.com/go-resty/resty/v2 v2.7.0
 	github.com/google/go-github/v45 v45.2.0
 	github.com/inhies/go-bytesize v0.0.0-20220417184213-4913239db9cf
+	github.com/manifoldco/promptui v0.9.0
 	github.com/spf13/cobra v1.5.0
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -16,14 +18,12 @@ require (
 	github.com/andybalholm/brotli v1.0.4 // indirect
 	github.com/bodgit/plumbing v1.2.0 // indirect
 	github.com/bodgit/windows v1.0.0 // indirect
-	github.com/chzyer/readline v1.5.0 // indirect
 	github.com/connesc/cipherio v0.2.1 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/klauspost/compress v1.15.7 // indirect
-	github.com/manifoldco/promptui v0.9.0 // indirect
 	github.com/pierrec/lz4/v4 v4.1.15 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/ulikunitz/xz v0.5.10 // indirect
@@ -1,7 +1,10 @@
 package swizzle
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"strings"
 )
@@ -27,7 +30,156 @@ type archiveData struct {
 // file archive formats
 type Archive interface {
 	Location() string
-	Unpack(dst string, src string) error
+	List(src string) ([]ArchiveFile, error)
+	Unpack(dst string, src string, opts ...UnpackOption) error
+}
+
+// ArchiveFile is a file in an archive.
+type ArchiveFile struct {
+	// Name is the slash separated file path relative to the archive source
+	// directory.
+	Name string `json:"name"`
+
+	// Size is the uncompressed file size in bytes.
+	Size int64 `json:"size"`
+}
+
+// UnpackOption configures how an Archive is unpacked.
+type UnpackOption func(*unpackOptions)
+
+// unpackOptions is the set of options for Archive.Unpack.
+type unpackOptions struct {
+	ctx       context.Context
+	mergeCase bool
+	files     map[string]bool
+}
+
+// WithContext stops unpacking with the context error when the context is
+// canceled, checked before each archive entry.
+func WithContext(ctx context.Context) UnpackOption {
+	return func(o *unpackOptions) {
+		o.ctx = ctx
+	}
+}
+
+// MergeCase resolves every unpacked path against existing files and directories
+// case insensitively, reusing the existing casing. Mods authored for Windows
+// assume a case insensitive file system, so without this option unpacking on
+// Linux can create both Data/Textures and Data/textures.
+func MergeCase() UnpackOption {
+	return func(o *unpackOptions) {
+		o.mergeCase = true
+	}
+}
+
+// OnlyFiles unpacks only the named files, which are slash separated paths
+// relative to the archive source directory as returned by List. Names are
+// matched case insensitively.
+func OnlyFiles(names ...string) UnpackOption {
+	return func(o *unpackOptions) {
+		o.files = map[string]bool{}
+		for _, n := range names {
+			o.files[lowerPath(n)] = true
+		}
+	}
+}
+
+// archiveEntry is a single file or directory in an archive.
+type archiveEntry struct {
+	name  string
+	isDir bool
+	mode  os.FileMode
+	size  int64
+	open  func() (io.ReadCloser, error)
+}
+
+// list returns the files in the archive entries inside src.
+func list(entries []archiveEntry, src string) []ArchiveFile {
+	var files []ArchiveFile
+	for _, e := range entries {
+		if e.isDir {
+			continue
+		}
+
+		// names match the paths written by unpack
+		rel := cleanPath(strings.Replace(e.name, src, "", 1))
+		if rel == "" {
+			continue
+		}
+		files = append(files, ArchiveFile{
+			Name: rel,
+			Size: e.size,
+		})
+	}
+	return files
+}
+
+// unpack writes the archive entries inside src to the dst directory.
+func unpack(entries []archiveEntry, dst string, src string, opts []UnpackOption) error {
+	o := &unpackOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var resolver *caseResolver
+	if o.mergeCase {
+		resolver = newCaseResolver(dst)
+	}
+
+	for _, e := range entries {
+		if o.ctx != nil {
+			if err := o.ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		// entry names are cleaned to a relative path, so entries like
+		// ../../x are written inside dst
+		rel := cleanPath(strings.Replace(e.name, src, "", 1))
+		if rel == "" {
+			continue
+		}
+		if o.files != nil && (e.isDir || !o.files[lowerPath(rel)]) {
+			continue
+		}
+
+		filePath := filepath.Join(dst, filepath.FromSlash(rel))
+		if resolver != nil {
+			filePath = resolver.Resolve(rel)
+		}
+		if !strings.HasPrefix(filePath, filepath.Clean(dst)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid archive file path '%s'", e.name)
+		}
+
+		if e.isDir {
+			os.MkdirAll(filePath, os.ModePerm)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+			return err
+		}
+
+		dstFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, e.mode)
+		if err != nil {
+			return err
+		}
+
+		fileInArchive, err := e.open()
+		if err != nil {
+			dstFile.Close()
+			return err
+		}
+
+		_, err = io.Copy(dstFile, fileInArchive)
+		dstFile.Close()
+		fileInArchive.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // UnknownArchive is an Archive format which cannot be identified.
@@ -39,7 +191,11 @@ func (a UnknownArchive) Location() string {
 	return a.location
 }
 
-func (a UnknownArchive) Unpack(dst, src string) error {
+func (a UnknownArchive) List(src string) ([]ArchiveFile, error) {
+	return nil, fmt.Errorf("unknown archive format")
+}
+
+func (a UnknownArchive) Unpack(dst, src string, opts ...UnpackOption) error {
 	return fmt.Errorf("unknown archive format")
 }
 
@@ -2,9 +2,6 @@ package swizzle
 
 import (
 	"io"
-	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/bodgit/sevenzip"
 )
@@ -19,44 +16,40 @@ func (a SevenZArchive) Location() string {
 	return a.location
 }
 
-func (a SevenZArchive) Unpack(dst string, src string) error {
+func (a SevenZArchive) List(src string) ([]ArchiveFile, error) {
 	f, err := sevenzip.OpenReader(a.location)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer f.Close()
+
+	return list(a.entries(f.File), src), nil
+}
 
-	for _, file := range f.File {
-		filePath := filepath.Clean(filepath.Join(dst, strings.Replace(file.Name, src, "", 1)))
-		/*if !strings.HasPrefix(filePath, filepath.Clean(dst)+string(os.PathSeparator)) {
-			return fmt.Errorf("invalid file path")
-		}*/
-
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(filePath, os.ModePerm)
-			continue
-		}
-
-		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
-			return err
-		}
-
-		dstFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
-		if err != nil {
-			return err
-		}
-
-		fileInArchive, err := file.Open()
-		if err != nil {
-			return err
-		}
-
-		if _, err := io.Copy(dstFile, fileInArchive); err != nil {
-			return err
-		}
-
-		dstFile.Close()
-		fileInArchive.Close()
+func (a SevenZArchive) Unpack(dst string, src string, opts ...UnpackOption) error {
+	f, err := sevenzip.OpenReader(a.location)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
+
+	return unpack(a.entries(f.File), dst, src, opts)
+}
 
-	return nil
+// entries returns the archiveEntry for every file in the archive.
+func (a SevenZArchive) entries(files []*sevenzip.File) []archiveEntry {
+	entries := make([]archiveEntry, 0, len(files))
+	for _, file := range files {
+		file := file
+		entries = append(entries, archiveEntry{
+			name:  file.Name,
+			isDir: file.FileInfo().IsDir(),
+			mode:  file.Mode(),
+			size:  file.FileInfo().Size(),
+			open: func() (io.ReadCloser, error) {
+				return file.Open()
+			},
+		})
+	}
+	return entries
 }
@@ -3,9 +3,6 @@ package swizzle
 import (
 	"archive/zip"
 	"io"
-	"os"
-	"path/filepath"
-	"strings"
 )
 
 const ZipFileExtension FileExtension = ".zip"
@@ -18,45 +15,40 @@ func (a ZipArchive) Location() string {
 	return a.location
 }
 
-func (a ZipArchive) Unpack(dst string, src string) error {
+func (a ZipArchive) List(src string) ([]ArchiveFile, error) {
 	f, err := zip.OpenReader(a.location)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer f.Close()
 
-	for _, f := range f.File {
-		filePath := filepath.Clean(filepath.Join(dst, strings.Replace(f.Name, src, "", 1)))
-		/*if !strings.HasPrefix(filePath, filepath.Clean(dst)+string(os.PathSeparator)) {
-			return fmt.Errorf("invalid file path")
-		}*/
-
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(filePath, os.ModePerm)
-			continue
-		}
-
-		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
-			return err
-		}
-
-		dstFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-		if err != nil {
-			return err
-		}
-
-		fileInArchive, err := f.Open()
-		if err != nil {
-			return err
-		}
-
-		if _, err := io.Copy(dstFile, fileInArchive); err != nil {
-			return err
-		}
-
-		dstFile.Close()
-		fileInArchive.Close()
+	return list(a.entries(f.File), src), nil
+}
+
+func (a ZipArchive) Unpack(dst string, src string, opts ...UnpackOption) error {
+	f, err := zip.OpenReader(a.location)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
 
-	return nil
+	return unpack(a.entries(f.File), dst, src, opts)
+}
+
+// entries returns the archiveEntry for every file in the archive.
+func (a ZipArchive) entries(files []*zip.File) []archiveEntry {
+	entries := make([]archiveEntry, 0, len(files))
+	for _, file := range files {
+		file := file
+		entries = append(entries, archiveEntry{
+			name:  file.Name,
+			isDir: file.FileInfo().IsDir(),
+			mode:  file.Mode(),
+			size:  file.FileInfo().Size(),
+			open: func() (io.ReadCloser, error) {
+				return file.Open()
+			},
+		})
+	}
+	return entries
 }
@@ -0,0 +1,270 @@
+package swizzle
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/afloesch/semver"
+)
+
+// BSA archive flags.
+const (
+	bsaDirectoryNames uint32 = 0x1
+	bsaFileNames      uint32 = 0x2
+)
+
+// bethesdaArchiveExtensions are the file extensions for Bethesda archives.
+var bethesdaArchiveExtensions = map[string]bool{
+	".bsa": true,
+	".ba2": true,
+}
+
+// BethesdaArchive is the file table of a Bethesda game archive, a BSA
+// (Oblivion, Fallout 3, Skyrim) or BA2 (Fallout 4, Starfield).
+type BethesdaArchive struct {
+	// Name is the archive file name.
+	Name string `json:"name"`
+
+	// Format is BSA or BA2.
+	Format string `json:"format"`
+
+	// Version is the archive format version.
+	Version uint32 `json:"version"`
+
+	// Type is GNRL or DX10 for BA2 archives.
+	Type string `json:"type,omitempty"`
+
+	// Files is the path of every file in the archive, relative to the game
+	// Data directory, with forward slashes.
+	Files []string `json:"files"`
+}
+
+// IsBethesdaArchive checks whether a file name has a BSA or BA2 file
+// extension.
+func IsBethesdaArchive(name string) bool {
+	return bethesdaArchiveExtensions[strings.ToLower(path.Ext(filepath.ToSlash(name)))]
+}
+
+// ReadBethesdaArchive reads the file table from a BSA or BA2 archive on the
+// file system.
+func ReadBethesdaArchive(file string) (*BethesdaArchive, error) {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	a, err := ParseBethesdaArchive(f, filepath.Base(file))
+	if err != nil {
+		return nil, fmt.Errorf("'%s': %w", filepath.Base(file), err)
+	}
+	return a, nil
+}
+
+// ParseBethesdaArchive reads the file table from a BSA (v103, v104, v105) or
+// BA2 (GNRL, DX10) archive.
+func ParseBethesdaArchive(r io.ReadSeeker, name string) (*BethesdaArchive, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, fmt.Errorf("invalid archive header: %s", err)
+	}
+
+	a := &BethesdaArchive{Name: name}
+	var err error
+	switch string(magic[:]) {
+	case "BSA\x00":
+		a.Format = "BSA"
+		err = a.parseBSA(r)
+	case "BTDX":
+		a.Format = "BA2"
+		err = a.parseBA2(r)
+	default:
+		return nil, fmt.Errorf("invalid archive header: not a BSA or BA2 archive")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// parseBSA reads the folder and file name tables of a BSA archive. The reader
+// is positioned after the file id.
+func (a *BethesdaArchive) parseBSA(r io.ReadSeeker) error {
+	var hdr struct {
+		Version          uint32
+		Offset           uint32
+		Flags            uint32
+		FolderCount      uint32
+		FileCount        uint32
+		FolderNameLength uint32
+		FileNameLength   uint32
+		FileFlags        uint16
+		Padding          uint16
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return fmt.Errorf("invalid BSA header: %s", err)
+	}
+	a.Version = hdr.Version
+
+	// Skyrim Special Edition folder records have a 64 bit offset
+	folderRecord := int64(16)
+	switch hdr.Version {
+	case 103, 104:
+	case 105:
+		folderRecord = 24
+	default:
+		return fmt.Errorf("unsupported BSA version %d", hdr.Version)
+	}
+	if hdr.Flags&bsaDirectoryNames == 0 || hdr.Flags&bsaFileNames == 0 {
+		return fmt.Errorf("BSA archive does not include file names")
+	}
+
+	// table sizes come from the header, so they are checked against the file
+	// size before allocating
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if int64(hdr.FolderCount)*folderRecord > size || int64(hdr.FileCount)*16 > size || int64(hdr.FileNameLength) > size {
+		return fmt.Errorf("invalid BSA header: tables larger than the archive")
+	}
+
+	folders := make([]uint32, hdr.FolderCount)
+	if _, err := r.Seek(int64(hdr.Offset), io.SeekStart); err != nil {
+		return err
+	}
+	br := bufio.NewReader(r)
+	rec := make([]byte, folderRecord)
+	for i := range folders {
+		if _, err := io.ReadFull(br, rec); err != nil {
+			return fmt.Errorf("invalid BSA folder record: %s", err)
+		}
+		folders[i] = binary.LittleEndian.Uint32(rec[8:12])
+	}
+
+	// each file record block is the folder name followed by the file records
+	var dirs []string
+	var total uint32
+	file := make([]byte, 16)
+	for _, count := range folders {
+		n, err := br.ReadByte()
+		if err != nil {
+			return fmt.Errorf("invalid BSA folder name: %s", err)
+		}
+		dir := make([]byte, n)
+		if _, err := io.ReadFull(br, dir); err != nil {
+			return fmt.Errorf("invalid BSA folder name: %s", err)
+		}
+
+		for i := uint32(0); i < count; i++ {
+			if _, err := io.ReadFull(br, file); err != nil {
+				return fmt.Errorf("invalid BSA file record: %s", err)
+			}
+			dirs = append(dirs, zstring(dir))
+		}
+		total += count
+	}
+	if total != hdr.FileCount {
+		return fmt.Errorf("invalid BSA header: %d file records, expected %d", total, hdr.FileCount)
+	}
+
+	// file names are null terminated strings in file record order
+	names := make([]byte, hdr.FileNameLength)
+	if _, err := io.ReadFull(br, names); err != nil {
+		return fmt.Errorf("invalid BSA file names: %s", err)
+	}
+	for _, dir := range dirs {
+		if len(names) == 0 {
+			return fmt.Errorf("invalid BSA file names: truncated")
+		}
+		name := zstring(names)
+		if len(name) < len(names) {
+			names = names[len(name)+1:]
+		} else {
+			names = nil
+		}
+		a.Files = append(a.Files, archiveAssetPath(dir, name))
+	}
+	return nil
+}
+
+// parseBA2 reads the name table of a BA2 archive. The reader is positioned
+// after the file id.
+func (a *BethesdaArchive) parseBA2(r io.ReadSeeker) error {
+	var hdr struct {
+		Version         uint32
+		Type            [4]byte
+		FileCount       uint32
+		NameTableOffset uint64
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return fmt.Errorf("invalid BA2 header: %s", err)
+	}
+	a.Version = hdr.Version
+	a.Type = string(hdr.Type[:])
+	if a.Type != "GNRL" && a.Type != "DX10" {
+		return fmt.Errorf("unsupported BA2 archive type '%s'", a.Type)
+	}
+
+	if _, err := r.Seek(int64(hdr.NameTableOffset), io.SeekStart); err != nil {
+		return err
+	}
+	br := bufio.NewReader(r)
+	var size [2]byte
+	for i := uint32(0); i < hdr.FileCount; i++ {
+		if _, err := io.ReadFull(br, size[:]); err != nil {
+			return fmt.Errorf("invalid BA2 name table: %s", err)
+		}
+		name := make([]byte, binary.LittleEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(br, name); err != nil {
+			return fmt.Errorf("invalid BA2 name table: %s", err)
+		}
+		a.Files = append(a.Files, archiveAssetPath("", string(name)))
+	}
+	return nil
+}
+
+// archiveAssetPath joins a directory and file name from an archive file table
+// into a clean path with forward slashes.
+func archiveAssetPath(dir, name string) string {
+	return cleanPath(dir + "/" + name)
+}
+
+// Archives reads the file table of every BSA and BA2 archive in the game Data
+// directory of a staged mod release.
+func (s *Staging) Archives(repo Repo, version semver.String) ([]*BethesdaArchive, error) {
+	files, err := s.Files(repo, version)
+	if err != nil {
+		return nil, err
+	}
+
+	var archives []*BethesdaArchive
+	for _, f := range files {
+		if !isDataArchive(f) {
+			continue
+		}
+		a, err := ReadBethesdaArchive(f.Source)
+		if err != nil {
+			return nil, NewError(ErrCodeUnknown, repo, string(version), err)
+		}
+		archives = append(archives, a)
+	}
+
+	sort.SliceStable(archives, func(i, j int) bool {
+		return strings.ToLower(archives[i].Name) < strings.ToLower(archives[j].Name)
+	})
+	return archives, nil
+}
+
+// isDataArchive checks whether a staged file is a Bethesda archive loaded by
+// the game from the Data directory.
+func isDataArchive(f *StagedFile) bool {
+	return f.Root == GameRoot && lowerPath(path.Dir(f.Path)) == "data" && IsBethesdaArchive(f.Path)
+}
@@ -0,0 +1,196 @@
+package swizzle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// bsaFolder is a folder and its file names in a test BSA archive.
+type bsaFolder struct {
+	name  string
+	files []string
+}
+
+// bsaArchive encodes a BSA archive with the folder and file name tables.
+func bsaArchive(version uint32, flags uint32, folders []bsaFolder) []byte {
+	folderRecord := 16
+	if version == 105 {
+		folderRecord = 24
+	}
+
+	var records, blocks, names bytes.Buffer
+	fileCount, folderNames := 0, 0
+	for _, f := range folders {
+		rec := make([]byte, folderRecord)
+		binary.LittleEndian.PutUint32(rec[8:12], uint32(len(f.files)))
+		records.Write(rec)
+
+		blocks.WriteByte(byte(len(f.name) + 1))
+		blocks.WriteString(f.name + "\x00")
+		folderNames += len(f.name) + 1
+		for _, n := range f.files {
+			blocks.Write(make([]byte, 16))
+			names.WriteString(n + "\x00")
+			fileCount++
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("BSA\x00")
+	for _, v := range []uint32{version, 36, flags, uint32(len(folders)), uint32(fileCount), uint32(folderNames), uint32(names.Len())} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.Write(make([]byte, 4))
+	b.Write(records.Bytes())
+	b.Write(blocks.Bytes())
+	b.Write(names.Bytes())
+	return b.Bytes()
+}
+
+// ba2Archive encodes a BA2 archive with a name table after the header.
+func ba2Archive(typ string, names []string) []byte {
+	var b bytes.Buffer
+	b.WriteString("BTDX")
+	binary.Write(&b, binary.LittleEndian, uint32(1))
+	b.WriteString(typ)
+	binary.Write(&b, binary.LittleEndian, uint32(len(names)))
+	binary.Write(&b, binary.LittleEndian, uint64(24))
+	for _, n := range names {
+		binary.Write(&b, binary.LittleEndian, uint16(len(n)))
+		b.WriteString(n)
+	}
+	return b.Bytes()
+}
+
+func TestParseBethesdaArchive(t *testing.T) {
+	folders := []bsaFolder{
+		{name: `textures\armor`, files: []string{"iron.dds", "steel.dds"}},
+		{name: `meshes`, files: []string{"sword.nif"}},
+	}
+	files := []string{"textures/armor/iron.dds", "textures/armor/steel.dds", "meshes/sword.nif"}
+	names := bsaDirectoryNames | bsaFileNames
+
+	tests := []struct {
+		name    string
+		data    []byte
+		archive *BethesdaArchive
+		err     string
+	}{
+		{
+			name:    "BSA v103",
+			data:    bsaArchive(103, names, folders),
+			archive: &BethesdaArchive{Format: "BSA", Version: 103, Files: files},
+		},
+		{
+			name:    "BSA v104",
+			data:    bsaArchive(104, names, folders),
+			archive: &BethesdaArchive{Format: "BSA", Version: 104, Files: files},
+		},
+		{
+			name:    "BSA v105",
+			data:    bsaArchive(105, names, folders),
+			archive: &BethesdaArchive{Format: "BSA", Version: 105, Files: files},
+		},
+		{
+			name: "BA2 GNRL",
+			data: ba2Archive("GNRL", []string{`Meshes\Armor\Iron.nif`, "Sound/a.wav"}),
+			archive: &BethesdaArchive{
+				Format:  "BA2",
+				Version: 1,
+				Type:    "GNRL",
+				Files:   []string{"Meshes/Armor/Iron.nif", "Sound/a.wav"},
+			},
+		},
+		{
+			name:    "BA2 DX10",
+			data:    ba2Archive("DX10", []string{`Textures\a.dds`}),
+			archive: &BethesdaArchive{Format: "BA2", Version: 1, Type: "DX10", Files: []string{"Textures/a.dds"}},
+		},
+		{
+			name: "unknown format",
+			data: []byte("ZIP\x00"),
+			err:  "not a BSA or BA2 archive",
+		},
+		{
+			name: "unsupported BSA version",
+			data: bsaArchive(106, names, folders),
+			err:  "unsupported BSA version 106",
+		},
+		{
+			name: "BSA without file names",
+			data: bsaArchive(104, bsaDirectoryNames, folders),
+			err:  "does not include file names",
+		},
+		{
+			name: "BSA folder count larger than the archive",
+			data: func() []byte {
+				b := bsaArchive(104, names, folders)
+				binary.LittleEndian.PutUint32(b[16:20], 1<<30)
+				return b
+			}(),
+			err: "tables larger than the archive",
+		},
+		{
+			name: "BSA file name length larger than the archive",
+			data: func() []byte {
+				b := bsaArchive(104, names, folders)
+				binary.LittleEndian.PutUint32(b[28:32], 1<<30)
+				return b
+			}(),
+			err: "tables larger than the archive",
+		},
+		{
+			name: "BSA file count mismatch",
+			data: func() []byte {
+				b := bsaArchive(104, names, folders)
+				binary.LittleEndian.PutUint32(b[20:24], 4)
+				return b
+			}(),
+			err: "3 file records, expected 4",
+		},
+		{
+			name: "BSA truncated file names",
+			data: func() []byte {
+				b := bsaArchive(104, names, folders)
+				return b[:len(b)-4]
+			}(),
+			err: "invalid BSA file names",
+		},
+		{
+			name: "unsupported BA2 type",
+			data: ba2Archive("XBOX", nil),
+			err:  "unsupported BA2 archive type 'XBOX'",
+		},
+		{
+			name: "BA2 truncated name table",
+			data: func() []byte {
+				b := ba2Archive("GNRL", []string{"a.nif"})
+				return b[:len(b)-1]
+			}(),
+			err: "invalid BA2 name table",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := ParseBethesdaArchive(bytes.NewReader(tt.data), "test")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.archive.Name = "test"
+			if !reflect.DeepEqual(a, tt.archive) {
+				t.Errorf("got %+v, want %+v", a, tt.archive)
+			}
+		})
+	}
+}
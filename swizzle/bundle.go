@@ -0,0 +1,302 @@
+package swizzle
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/afloesch/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// bundleManifestName is the root manifest file in a bundle.
+const bundleManifestName string = "swizzle.yml"
+
+// bundleModDir is the bundle directory holding the release manifest and
+// release files of each mod, in <owner>/<repo>/<version>/ subdirectories.
+const bundleModDir string = "mods"
+
+// Bundle is a resolved manifest packed in a tar file with the lock, the
+// release manifest of every dependency, and every release file, so the
+// manifest installs without network access.
+type Bundle struct {
+	// Path is the bundle file location.
+	Path string `json:"path"`
+
+	Manifest *Manifest `json:"manifest"`
+	Lock     *Lock     `json:"lock"`
+
+	// Mods is the release manifest of every locked mod, in install order.
+	Mods []*Manifest `json:"mods"`
+}
+
+// bundleModPath returns the bundle path for a file of a mod release.
+func bundleModPath(m *Manifest, name string) string {
+	return path.Join(bundleModDir, m.Repo.Organization(), m.Repo.Name(), m.Version.Get().String(), name)
+}
+
+// CreateBundle writes a bundle for a manifest and its resolved dependency
+// graph to a tar file. Every release file must already be downloaded to the
+// cache directory. The file is written to a temporary file first, so a failed
+// bundle never replaces an existing file.
+func CreateBundle(file string, m *Manifest, g *Graph, cache string) (*Bundle, error) {
+	b := &Bundle{Path: filepath.Clean(file), Manifest: m, Lock: g.Lock()}
+	for _, n := range g.InstallOrder() {
+		mod := n.Manifest()
+		for _, f := range mod.Files {
+			if !f.Cached(cache, mod) {
+				return nil, NewError(ErrCodeNotFound, mod.Repo, string(mod.Version), fmt.Errorf("release file '%s' is not downloaded", f.Name))
+			}
+		}
+		b.Mods = append(b.Mods, mod)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(b.Path), ".bundle-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := b.write(tmp); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	return b, os.Rename(tmp.Name(), b.Path)
+}
+
+// write writes the root manifest, lock, release manifests and release files
+// to a tar stream. Manifests come first, so reading a bundle stops before the
+// release files.
+func (b *Bundle) write(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	now := time.Now().UTC()
+
+	writeYAML := func(name string, v interface{}) error {
+		content, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = tw.Write(content)
+		return err
+	}
+
+	if err := writeYAML(bundleManifestName, b.Manifest); err != nil {
+		return err
+	}
+	if err := writeYAML(lockName, b.Lock); err != nil {
+		return err
+	}
+	for _, mod := range b.Mods {
+		if err := writeYAML(bundleModPath(mod, manifestName), mod); err != nil {
+			return err
+		}
+	}
+
+	for _, mod := range b.Mods {
+		for _, f := range mod.Files {
+			if err := writeTarFile(tw, bundleModPath(mod, f.Name), f.Archive().Location(), now); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+// writeTarFile adds a file from the file system to a tar stream.
+func writeTarFile(tw *tar.Writer, name, file string, modTime time.Time) error {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: modTime}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// OpenBundle reads the root manifest, lock and release manifests from a
+// bundle file. Every locked mod must have a release manifest in the bundle.
+func OpenBundle(file string) (*Bundle, error) {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := &Bundle{Path: filepath.Clean(file)}
+	mods := map[string]*Manifest{}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle '%s': %s", file, err)
+		}
+
+		name := path.Clean(hdr.Name)
+		switch {
+		case name == bundleManifestName:
+			b.Manifest, err = readBundleManifest(tr)
+		case name == lockName:
+			b.Lock = &Lock{}
+			err = yaml.NewDecoder(tr).Decode(b.Lock)
+		case path.Base(name) == manifestName:
+			mods[path.Dir(name)], err = readBundleManifest(tr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle '%s': '%s': %s", file, name, err)
+		}
+	}
+
+	if b.Manifest == nil || b.Lock == nil {
+		return nil, NewError(ErrCodeInvalidInput, "", "", fmt.Errorf("invalid bundle '%s': missing %s or %s", file, bundleManifestName, lockName))
+	}
+	for _, l := range b.Lock.Mods {
+		mod, ok := mods[path.Dir(bundleModPath(&Manifest{Repo: l.Repo, Version: l.Version}, manifestName))]
+		if !ok {
+			return nil, NewError(ErrCodeNotFound, l.Repo, string(l.Version), fmt.Errorf("bundle has no release manifest for '%s' version '%s'", l.Repo, l.Version))
+		}
+
+		// release file names are used as cache file names, and unlike
+		// downloads are not checked against the release assets
+		for _, f := range mod.Files {
+			if f.Name == "" || f.Name == "." || f.Name == ".." || strings.ContainsAny(f.Name, `/\`) {
+				return nil, NewError(ErrCodeInvalidInput, l.Repo, string(l.Version), fmt.Errorf("invalid bundle '%s': invalid release file name '%s'", file, f.Name))
+			}
+		}
+		b.Mods = append(b.Mods, mod)
+	}
+	return b, nil
+}
+
+// readBundleManifest parses a manifest from a bundle entry.
+func readBundleManifest(r io.Reader) (*Manifest, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(data)
+}
+
+// Graph returns the dependency graph for the bundle manifest, resolved from
+// the bundled release manifests at the locked versions.
+func (b *Bundle) Graph() (*Graph, error) {
+	mods := map[Repo]*Manifest{}
+	for _, m := range b.Mods {
+		mods[m.Repo] = m
+	}
+
+	return b.Manifest.graph(func(repo Repo, ver semver.String) (*Manifest, error) {
+		m, ok := mods[repo]
+		if !ok {
+			return nil, NewError(ErrCodeNotFound, repo, string(ver), fmt.Errorf("bundle has no release manifest for '%s'", repo))
+		}
+		return m, nil
+	})
+}
+
+// Extract copies every bundled release file to the cache directory, named as
+// downloaded release files so installs use them without downloading. Release
+// files already in the cache matching the release file hash are kept.
+func (b *Bundle) Extract(cache string) error {
+	files := map[string]*ReleaseFile{}
+	owners := map[string]*Manifest{}
+	for _, m := range b.Mods {
+		for _, f := range m.Files {
+			files[bundleModPath(m, f.Name)] = f
+			owners[bundleModPath(m, f.Name)] = m
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Clean(cache), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Open(b.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid bundle '%s': %s", b.Path, err)
+		}
+
+		name := path.Clean(hdr.Name)
+		rf, ok := files[name]
+		if !ok {
+			continue
+		}
+		m := owners[name]
+
+		// cached files are only kept when they match the release file hash
+		a := NewArchive(rf.archiveName(m), filepath.Clean(cache))
+		if info, err := os.Stat(a.Location()); err == nil && info.Size() == hdr.Size && rf.Hash != "" && rf.verifyHash(a.Location()) == nil {
+			continue
+		}
+		if err := extractTarFile(tr, a.Location()); err != nil {
+			return NewError(ErrCodeUnknown, m.Repo, string(m.Version), err)
+		}
+		if err := rf.verifyHash(a.Location()); err != nil {
+			os.Remove(a.Location())
+			return NewError(ErrCodeUnknown, m.Repo, string(m.Version), err)
+		}
+	}
+
+	for name, rf := range files {
+		m := owners[name]
+		if !rf.Cached(cache, m) {
+			return NewError(ErrCodeNotFound, m.Repo, string(m.Version), fmt.Errorf("bundle has no release file '%s'", rf.Name))
+		}
+	}
+	return nil
+}
+
+// extractTarFile writes the current tar entry to a file, through a temporary
+// file so a partial copy never looks like a cached release file.
+func extractTarFile(r io.Reader, file string) error {
+	tmp := file + ".swizzle"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,249 @@
+package swizzle
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const configName string = "config.yml"
+
+// GameConfig is a named game install configured in the swizzle config file.
+type GameConfig struct {
+	// Name is the game profile name, for example "skyrimse". The name is
+	// set from the key in the config file games map.
+	Name string `json:"name,omitempty" yaml:"-"`
+
+	// Directory is the game install directory.
+	Directory string `json:"directory,omitempty" yaml:"directory,omitempty"`
+
+	// Executable is the game executable file name, which is matched with
+	// the Game.Executable value in mod manifests.
+	Executable string `json:"executable,omitempty" yaml:"executable,omitempty"`
+
+	// Staging is the directory mods are extracted to before being deployed
+	// to the game directory.
+	Staging string `json:"staging,omitempty" yaml:"staging,omitempty"`
+
+	// Manifest is the default swizzle manifest file for the game.
+	Manifest string `json:"manifest,omitempty" yaml:"manifest,omitempty"`
+
+	// Token is an optional GitHub token, which overrides the global token.
+	Token string `json:"token,omitempty" yaml:"token,omitempty"`
+
+	// Cache is the directory downloaded release files are stored in, which
+	// overrides the global cache directory.
+	Cache string `json:"cache,omitempty" yaml:"cache,omitempty"`
+
+	// AppID is the Steam app id for the game. Defaults to the app id of the
+	// Steam install for the game directory.
+	AppID string `json:"appid,omitempty" yaml:"appid,omitempty"`
+
+	// Prefix is the Proton prefix for the game. Defaults to the compatdata
+	// prefix for the app id in the Steam library of the game directory.
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+
+	// UserData is the game folder name in the Windows user Documents/My Games
+	// and AppData/Local directories, for example "Skyrim Special Edition".
+	// Defaults to the known folder name for the app id.
+	UserData string `json:"userdata,omitempty" yaml:"userdata,omitempty"`
+
+	config *Config
+}
+
+// Config is the global swizzle configuration file.
+type Config struct {
+	// Token is an optional GitHub token used for all GitHub requests.
+	Token string `json:"token,omitempty" yaml:"token,omitempty"`
+
+	// Cache is the default directory for downloaded release files.
+	Cache string `json:"cache,omitempty" yaml:"cache,omitempty"`
+
+	// Games is the set of configured game installs by name.
+	Games map[string]*GameConfig `json:"games,omitempty" yaml:"games,omitempty"`
+
+	path string
+}
+
+// DefaultConfigPath returns the default config file location, which is
+// config.yml in the swizzle user config directory, for example
+// ~/.config/swizzle/config.yml.
+func DefaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "swizzle", configName)
+}
+
+// LoadConfig reads the config file at the given path. A missing config file
+// returns an empty config.
+func LoadConfig(path string) (*Config, error) {
+	c := &Config{
+		Games: map[string]*GameConfig{},
+		path:  filepath.Clean(path),
+	}
+
+	b, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return c, c.resolve()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("invalid config '%s': %s", c.path, err)
+	}
+	if c.Games == nil {
+		c.Games = map[string]*GameConfig{}
+	}
+
+	return c, c.resolve()
+}
+
+// WriteFile writes the config to the path it was loaded from.
+func (c *Config) WriteFile() error {
+	content, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, content, 0600)
+}
+
+// Path returns the config file location.
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Game returns the configured game with the given name.
+func (c *Config) Game(name string) (*GameConfig, error) {
+	g, ok := c.Games[name]
+	if !ok {
+		return nil, NewError(ErrCodeNotFound, "", "", fmt.Errorf("game '%s' not found in '%s'", name, c.path))
+	}
+	return g, nil
+}
+
+// GameNames returns the configured game names in sorted order.
+func (c *Config) GameNames() []string {
+	names := make([]string, 0, len(c.Games))
+	for k := range c.Games {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MatchGame finds the configured game for a manifest by matching the game
+// executable. A game is only returned if exactly one configured game matches.
+func (c *Config) MatchGame(m *Manifest) (*GameConfig, bool) {
+	if m == nil || m.Game.Executable == "" {
+		return nil, false
+	}
+
+	var match *GameConfig
+	for _, name := range c.GameNames() {
+		g := c.Games[name]
+		if strings.EqualFold(g.Executable, m.Game.Executable) {
+			if match != nil {
+				return nil, false
+			}
+			match = g
+		}
+	}
+
+	return match, match != nil
+}
+
+// resolve sets the name and parent config for each game.
+func (c *Config) resolve() error {
+	for name, g := range c.Games {
+		g.Name = name
+		g.config = c
+	}
+	return nil
+}
+
+// AddGame adds or replaces a configured game.
+func (c *Config) AddGame(g *GameConfig) {
+	c.Games[g.Name] = g
+	g.config = c
+}
+
+// CacheDir returns the global cache directory, which defaults to swizzle in the
+// user cache directory.
+func (c *Config) CacheDir() string {
+	if c.Cache != "" {
+		return expandHome(c.Cache)
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "swizzle")
+}
+
+// GameDir returns the game install directory.
+func (g *GameConfig) GameDir() string {
+	return expandHome(g.Directory)
+}
+
+// ManifestFile returns the default manifest file for the game.
+func (g *GameConfig) ManifestFile() string {
+	return expandHome(g.Manifest)
+}
+
+// CacheDir returns the release file cache directory for the game.
+func (g *GameConfig) CacheDir() string {
+	if g.Cache != "" {
+		return expandHome(g.Cache)
+	}
+	return g.config.CacheDir()
+}
+
+// StagingDir returns the mod staging directory for the game, which defaults
+// to staging/<game name> in the cache directory.
+func (g *GameConfig) StagingDir() string {
+	if g.Staging != "" {
+		return expandHome(g.Staging)
+	}
+	return filepath.Join(g.config.CacheDir(), "staging", g.Name)
+}
+
+// GitHubToken returns the GitHub token for the game, which defaults to the
+// global token.
+func (g *GameConfig) GitHubToken() string {
+	if g.Token != "" {
+		return g.Token
+	}
+	return g.config.Token
+}
+
+// ExecutablePath returns the path to the game executable in the game directory.
+func (g *GameConfig) ExecutablePath() string {
+	return filepath.Join(g.GameDir(), g.Executable)
+}
+
+// expandHome replaces a leading ~ in a path with the user home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,347 @@
+package swizzle
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Conflict is a file provided by more than one mod.
+type Conflict struct {
+	DeployedPath
+
+	// Mods is every mod providing the file, in deploy order.
+	Mods []Repo `json:"mods"`
+
+	// Winner is the mod whose file is deployed.
+	Winner Repo `json:"winner"`
+
+	// Override is true when the winner is set by a manifest override.
+	Override bool `json:"override,omitempty"`
+}
+
+// AssetProvider is a mod providing an asset in the game Data directory, as a
+// loose file or packed in a Bethesda archive.
+type AssetProvider struct {
+	Repo Repo `json:"repo"`
+
+	// Archive is the BSA or BA2 archive containing the asset, empty for a
+	// loose file.
+	Archive string `json:"archive,omitempty"`
+
+	// rank is the load order position of the plugin loading the archive.
+	rank int
+}
+
+// ArchiveConflict is an asset provided by more than one mod, where at least
+// one mod packs the asset in a Bethesda archive.
+type ArchiveConflict struct {
+	// Path is the asset path relative to the game Data directory.
+	Path string `json:"path"`
+
+	// Providers is every mod providing the asset, in deploy order.
+	Providers []*AssetProvider `json:"providers"`
+
+	// Winner is the provider the game loads the asset from.
+	Winner *AssetProvider `json:"winner"`
+}
+
+// Plan is the set of staged files to deploy to the game, and the conflicts
+// between mods.
+type Plan struct {
+	// Mods is every mod in deploy order.
+	Mods []*LockedMod `json:"mods"`
+
+	// Files is the winning staged file for every deployed path.
+	Files []*StagedFile `json:"files"`
+
+	// Conflicts is every path provided by more than one mod.
+	Conflicts []*Conflict `json:"conflicts"`
+
+	// INI is the winning value for every INI key set by a mod.
+	INI []*INISetting `json:"ini,omitempty"`
+
+	// INIConflicts is every INI key set to different values by more than
+	// one mod.
+	INIConflicts []*INIConflict `json:"iniConflicts,omitempty"`
+}
+
+// DeployOrder returns the mods sorted by the manifest priority. Mods listed in
+// the priority list are moved after all unlisted mods in the listed order.
+// Unlisted mods keep their install order.
+func (m *Manifest) DeployOrder(mods []*LockedMod) []*LockedMod {
+	rank := map[Repo]int{}
+	for i, r := range m.Priority {
+		rank[r] = i + 1
+	}
+
+	ordered := make([]*LockedMod, len(mods))
+	copy(ordered, mods)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return rank[ordered[i].Repo] < rank[ordered[j].Repo]
+	})
+	return ordered
+}
+
+// Plan returns the deploy plan for the manifest mods. Mods are ordered by the
+// manifest priority, and file conflicts are resolved with the manifest
+// overrides. INI tweaks are applied in deploy order, followed by the manifest
+// INI tweaks.
+func (s *Staging) Plan(m *Manifest, mods []*LockedMod) (*Plan, error) {
+	files := map[Repo][]*StagedFile{}
+	for _, mod := range mods {
+		f, err := s.Files(mod.Repo, mod.Version)
+		if err != nil {
+			return nil, err
+		}
+		files[mod.Repo] = f
+	}
+
+	p, err := m.plan(mods, files)
+	if err != nil {
+		return nil, err
+	}
+
+	modINI := map[Repo][]*INITweak{}
+	for _, mod := range p.Mods {
+		r, err := s.Release(mod.Repo, mod.Version)
+		if err != nil {
+			return nil, err
+		}
+		modINI[mod.Repo] = r.INI
+	}
+	return p, p.planModINI(m, modINI)
+}
+
+// planModINI resolves the INI tweaks of each mod in deploy order, followed by
+// the manifest INI tweaks.
+func (p *Plan) planModINI(m *Manifest, modINI map[Repo][]*INITweak) error {
+	var settings []*INISetting
+	for _, mod := range p.Mods {
+		for _, t := range modINI[mod.Repo] {
+			settings = append(settings, &INISetting{INITweak: *t, Repo: mod.Repo})
+		}
+	}
+	for _, t := range m.INI {
+		settings = append(settings, &INISetting{INITweak: *t, Repo: m.Repo})
+	}
+	return p.planINI(settings)
+}
+
+// plan returns the deploy plan for the files provided by each mod.
+func (m *Manifest) plan(mods []*LockedMod, modFiles map[Repo][]*StagedFile) (*Plan, error) {
+	p := &Plan{Mods: m.DeployOrder(mods)}
+
+	overrides := map[DeployedPath]Repo{}
+	for k, v := range m.Overrides {
+		root, file := splitOverride(k)
+		overrides[pathKey(root, file)] = v
+	}
+
+	providers := map[DeployedPath][]*StagedFile{}
+	var keys []DeployedPath
+	for _, mod := range p.Mods {
+		for _, f := range modFiles[mod.Repo] {
+			k := pathKey(f.Root, f.Path)
+			if _, ok := providers[k]; !ok {
+				keys = append(keys, k)
+			}
+			providers[k] = append(providers[k], f)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Root != keys[j].Root {
+			return keys[i].Root < keys[j].Root
+		}
+		return keys[i].Path < keys[j].Path
+	})
+
+	for _, k := range keys {
+		files := providers[k]
+		winner := files[len(files)-1]
+
+		repo, override := overrides[k]
+		if override {
+			var found bool
+			for _, f := range files {
+				if f.Repo == repo {
+					winner, found = f, true
+				}
+			}
+			if !found {
+				return nil, NewError(ErrCodeInvalidInput, repo, "", fmt.Errorf(
+					"override for '%s': '%s' does not provide the file", k.Path, repo,
+				))
+			}
+			delete(overrides, k)
+		}
+
+		p.Files = append(p.Files, winner)
+		if len(files) < 2 {
+			continue
+		}
+
+		c := &Conflict{
+			DeployedPath: DeployedPath{Root: winner.Root, Path: winner.Path},
+			Winner:       winner.Repo,
+			Override:     override,
+		}
+		for _, f := range files {
+			c.Mods = append(c.Mods, f.Repo)
+		}
+		p.Conflicts = append(p.Conflicts, c)
+	}
+
+	for k, repo := range overrides {
+		return nil, NewError(ErrCodeInvalidInput, repo, "", fmt.Errorf(
+			"override for '%s': no mod provides the file", k.Path,
+		))
+	}
+
+	return p, nil
+}
+
+// splitOverride splits a manifest override key into the install root and
+// the path relative to the root.
+func splitOverride(key string) (InstallRoot, string) {
+	root := GameRoot
+	parts := strings.SplitN(key, ":", 2)
+	if len(parts) == 2 {
+		switch InstallRoot(parts[0]) {
+		case GameRoot, DocumentsRoot, AppDataRoot:
+			root, key = InstallRoot(parts[0]), parts[1]
+		}
+	}
+	return root, path.Clean(strings.TrimPrefix(strings.ReplaceAll(key, "\\", "/"), "/"))
+}
+
+// ArchiveConflicts lists the contents of every BSA and BA2 archive in the
+// plan, and returns each asset provided by more than one mod where at least
+// one mod packs the asset in an archive. Loose files always win over archived
+// assets, and archives win over archives loaded by plugins earlier in the load
+// order. Plugins in the plan which are not in the load order are ranked after
+// it in deploy order, and archives without a plugin are ranked first. A nil
+// load order ranks every plugin in deploy order.
+func (p *Plan) ArchiveConflicts(lo *LoadOrder) ([]*ArchiveConflict, error) {
+	rank := map[Repo]int{}
+	for i, m := range p.Mods {
+		rank[m.Repo] = i
+	}
+
+	var files []*StagedFile
+	for _, f := range p.Files {
+		if f.Root == GameRoot && strings.HasPrefix(lowerPath(f.Path), "data/") {
+			files = append(files, f)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return rank[files[i].Repo] < rank[files[j].Repo]
+	})
+	plugins := pluginRanks(lo, files)
+
+	providers := map[string][]*AssetProvider{}
+	names := map[string]string{}
+	var keys []string
+	add := func(asset string, provider *AssetProvider) {
+		key := strings.ToLower(asset)
+		if _, ok := providers[key]; !ok {
+			keys = append(keys, key)
+			names[key] = asset
+		}
+		providers[key] = append(providers[key], provider)
+	}
+
+	for _, f := range files {
+		if !isDataArchive(f) {
+			add(f.Path[len("data/"):], &AssetProvider{Repo: f.Repo})
+			continue
+		}
+		a, err := ReadBethesdaArchive(f.Source)
+		if err != nil {
+			return nil, NewError(ErrCodeUnknown, f.Repo, string(f.Version), err)
+		}
+		r := archiveRank(plugins, a.Name)
+		for _, asset := range a.Files {
+			add(asset, &AssetProvider{Repo: f.Repo, Archive: a.Name, rank: r})
+		}
+	}
+	sort.Strings(keys)
+
+	var conflicts []*ArchiveConflict
+	for _, k := range keys {
+		list := providers[k]
+		if len(list) < 2 {
+			continue
+		}
+
+		var winner, loose *AssetProvider
+		archived := false
+		for _, pr := range list {
+			if pr.Archive == "" {
+				loose = pr
+			} else {
+				archived = true
+				if winner == nil || pr.rank >= winner.rank {
+					winner = pr
+				}
+			}
+		}
+		if !archived {
+			continue
+		}
+		if loose != nil {
+			winner = loose
+		}
+
+		conflicts = append(conflicts, &ArchiveConflict{
+			Path:      names[k],
+			Providers: list,
+			Winner:    winner,
+		})
+	}
+	return conflicts, nil
+}
+
+// pluginRanks returns the load order position of every plugin by lower case
+// name without the extension. Plugins in the Data directory files which are
+// not in the load order are ranked after it in file order.
+func pluginRanks(lo *LoadOrder, files []*StagedFile) map[string]int {
+	ranks := map[string]int{}
+	add := func(name string) {
+		key := strings.ToLower(strings.TrimSuffix(name, path.Ext(name)))
+		if _, ok := ranks[key]; !ok {
+			ranks[key] = len(ranks)
+		}
+	}
+
+	if lo != nil {
+		for _, pl := range lo.Plugins {
+			add(pl.Name)
+		}
+	}
+	for _, f := range files {
+		if lowerPath(path.Dir(f.Path)) == "data" && IsPlugin(f.Path) {
+			add(path.Base(f.Path))
+		}
+	}
+	return ranks
+}
+
+// archiveRank returns the rank of the plugin loading an archive, or -1 when no
+// plugin loads the archive. The game loads archives named after a plugin, or
+// after a plugin followed by " - " and a suffix, such as "Plugin - Textures.ba2".
+func archiveRank(plugins map[string]int, archive string) int {
+	name := strings.ToLower(strings.TrimSuffix(archive, path.Ext(archive)))
+	for {
+		if r, ok := plugins[name]; ok {
+			return r
+		}
+		i := strings.LastIndex(name, " - ")
+		if i < 0 {
+			return -1
+		}
+		name = name[:i]
+	}
+}
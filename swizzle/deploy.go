@@ -0,0 +1,381 @@
+package swizzle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/afloesch/semver"
+)
+
+const deploymentName string = "deployment.json"
+const backupDir string = ".backup"
+
+// DeployMethod is how staged files are deployed to the game.
+type DeployMethod string
+
+const (
+	// HardlinkDeploy deploys files as hard links to the staged files. When
+	// the staging directory is on a different file system than the game,
+	// files are deployed as symbolic links instead.
+	HardlinkDeploy DeployMethod = "hardlink"
+
+	// SymlinkDeploy deploys files as symbolic links to the staged files.
+	SymlinkDeploy DeployMethod = "symlink"
+
+	// CopyDeploy deploys copies of the staged files.
+	CopyDeploy DeployMethod = "copy"
+)
+
+// DeployedPath is a path created by a deployment, relative to an install root.
+type DeployedPath struct {
+	Root InstallRoot `json:"root"`
+	Path string      `json:"path"`
+}
+
+// DeployedFile is a staged file deployed to the game.
+type DeployedFile struct {
+	DeployedPath
+
+	// Source is the staged file location.
+	Source string `json:"source"`
+
+	Repo    Repo          `json:"repo"`
+	Version semver.String `json:"version"`
+
+	// Method is how the file was deployed.
+	Method DeployMethod `json:"method"`
+
+	// Hash is the sha256 hash of the file when it was deployed.
+	Hash string `json:"hash,omitempty"`
+
+	// SourceHash is the sha256 hash of the staged file, when the deployed
+	// file was changed by an INI tweak.
+	SourceHash string `json:"sourceHash,omitempty"`
+
+	// Backup is the location of the original game file replaced by the
+	// deployed file, which is restored when the deployment is purged.
+	Backup string `json:"backup,omitempty"`
+}
+
+// Deployment is the record of all files deployed from the staging directory
+// to the game.
+type Deployment struct {
+	Method DeployMethod    `json:"method,omitempty"`
+	Mods   []*LockedMod    `json:"mods"`
+	Files  []*DeployedFile `json:"files"`
+	Dirs   []*DeployedPath `json:"dirs"`
+
+	// INI is every INI setting applied by the deployment, in order.
+	INI []*DeployedINI `json:"ini,omitempty"`
+}
+
+// Deployment reads the current deployment record from the staging directory.
+// An empty deployment is returned if nothing is deployed.
+func (s *Staging) Deployment() (*Deployment, error) {
+	b, err := ioutil.ReadFile(filepath.Join(s.Dir, deploymentName))
+	if os.IsNotExist(err) {
+		return &Deployment{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var d Deployment
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, fmt.Errorf("invalid deployment record: %s", err)
+	}
+	return &d, nil
+}
+
+// writeDeployment saves the deployment record to the staging directory.
+func (s *Staging) writeDeployment(d *Deployment) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.Dir, deploymentName), b, 0644)
+}
+
+// Deploy replaces any existing deployment with the staged files in the plan.
+// Original game files replaced by deployed files are backed up in the staging
+// directory. If any file fails to deploy or the context is canceled, the
+// previous deployment is restored.
+func (s *Staging) Deploy(ctx context.Context, g *GameConfig, p *Plan, method DeployMethod) (*Deployment, error) {
+	t, err := s.Begin(g)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := t.Deploy(ctx, p, method)
+	if err != nil {
+		return d, t.fail(err)
+	}
+	return d, t.Commit()
+}
+
+// deployFile backs up any existing file at the target, creates missing parent
+// directories, and deploys the staged file.
+func (s *Staging) deployFile(rootDir, target string, df *DeployedFile, method DeployMethod, d *Deployment) error {
+	if _, err := os.Lstat(target); err == nil {
+		backup := filepath.Join(s.Dir, backupDir, string(df.Root), filepath.FromSlash(df.Path))
+		if err := os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+			return err
+		}
+		if err := moveFile(target, backup); err != nil {
+			return err
+		}
+		df.Backup = backup
+	}
+
+	created, err := mkdirAll(rootDir, filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	for _, dir := range created {
+		d.Dirs = append(d.Dirs, &DeployedPath{Root: df.Root, Path: dir})
+	}
+
+	return df.link(target, method)
+}
+
+// link deploys the staged file to the target with the deploy method.
+func (df *DeployedFile) link(target string, method DeployMethod) error {
+	switch method {
+	case HardlinkDeploy:
+		if err := os.Link(df.Source, target); err == nil {
+			return nil
+		}
+		df.Method = SymlinkDeploy
+		return os.Symlink(df.Source, target)
+	case SymlinkDeploy:
+		return os.Symlink(df.Source, target)
+	case CopyDeploy:
+		return replaceFile(df.Source, target)
+	}
+	return fmt.Errorf("unknown deploy method '%s'", method)
+}
+
+// Purge removes all deployed files from the game, and restores all original
+// game files replaced by the deployment. The purged deployment is returned.
+func (s *Staging) Purge(g *GameConfig) (*Deployment, error) {
+	d, err := s.Deployment()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.purge(g, d); err != nil {
+		return d, err
+	}
+
+	err = os.Remove(filepath.Join(s.Dir, deploymentName))
+	if err != nil && !os.IsNotExist(err) {
+		return d, err
+	}
+	return d, nil
+}
+
+// purge reverts the INI settings, and removes the deployed files and created
+// directories for a deployment. Settings in INI files deployed by the
+// deployment are removed with the file.
+func (s *Staging) purge(g *GameConfig, d *Deployment) error {
+	var revert []*DeployedINI
+	for _, set := range d.INI {
+		if f := d.file(set.installRoot(), cleanPath(set.File)); f != nil {
+			rootDir, err := g.RootDir(f.Root)
+			if err != nil {
+				return err
+			}
+			if f.isDeployed(filepath.Join(rootDir, filepath.FromSlash(f.Path))) {
+				continue
+			}
+		}
+		revert = append(revert, set)
+	}
+	if err := s.revertINI(g, revert); err != nil {
+		return err
+	}
+
+	for i := len(d.Files) - 1; i >= 0; i-- {
+		f := d.Files[i]
+		rootDir, err := g.RootDir(f.Root)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(rootDir, filepath.FromSlash(f.Path))
+		if f.isDeployed(target) {
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		if f.Backup != "" {
+			if _, err := os.Lstat(target); os.IsNotExist(err) {
+				err := moveFile(f.Backup, target)
+				if err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+		}
+	}
+
+	for i := len(d.Dirs) - 1; i >= 0; i-- {
+		dir := d.Dirs[i]
+		rootDir, err := g.RootDir(dir.Root)
+		if err != nil {
+			return err
+		}
+		// only empty directories are removed
+		os.Remove(filepath.Join(rootDir, filepath.FromSlash(dir.Path)))
+	}
+
+	return nil
+}
+
+// isDeployed checks whether the target is still the file deployed from staging.
+// Files changed or replaced after deployment are left in place when purging.
+// Copies are compared with the hash recorded at deploy time, or the staged
+// file for records without a hash.
+func (f *DeployedFile) isDeployed(target string) bool {
+	info, err := os.Lstat(target)
+	if err != nil {
+		return false
+	}
+
+	switch f.Method {
+	case SymlinkDeploy:
+		link, err := os.Readlink(target)
+		return err == nil && link == f.Source
+	case HardlinkDeploy:
+		src, err := os.Stat(f.Source)
+		return err == nil && os.SameFile(info, src)
+	}
+	if !info.Mode().IsRegular() {
+		return false
+	}
+
+	want := f.Hash
+	if want == "" {
+		if want, _, err = hashFile(f.Source); err != nil {
+			return false
+		}
+	}
+	hash, _, err := hashFile(target)
+	return err == nil && hash == want
+}
+
+// file returns the deployed file at a path, or nil when the deployment did not
+// deploy the path.
+func (d *Deployment) file(root InstallRoot, path string) *DeployedFile {
+	key := pathKey(root, path)
+	for i := len(d.Files) - 1; i >= 0; i-- {
+		if pathKey(d.Files[i].Root, d.Files[i].Path) == key {
+			return d.Files[i]
+		}
+	}
+	return nil
+}
+
+// tweak records a deployed file changed by an INI tweak. The changed file is
+// no longer linked to the staged file, so it is recorded as a copy with the
+// hash of the changed file, and the staged file hash is kept for repairs.
+func (f *DeployedFile) tweak(target string) error {
+	hash, _, err := hashFile(target)
+	if err != nil {
+		return err
+	}
+	if f.SourceHash == "" {
+		f.SourceHash = f.Hash
+	}
+	f.Method = CopyDeploy
+	f.Hash = hash
+	return nil
+}
+
+// pathKey returns the case insensitive map key for a path in an install root.
+func pathKey(root InstallRoot, path string) DeployedPath {
+	return DeployedPath{Root: root, Path: lowerPath(path)}
+}
+
+// mkdirAll creates dir and any missing parents, and returns the created
+// directories relative to root in creation order.
+func mkdirAll(root, dir string) ([]string, error) {
+	var missing []string
+	for d := dir; d != root && d != filepath.Dir(d); d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var created []string
+	for i := len(missing) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(root, missing[i])
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, filepath.ToSlash(rel))
+	}
+	return created, nil
+}
+
+// moveFile renames a file, copying it when the rename crosses file systems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// replaceFile copies a file next to the destination and renames it into
+// place, so a partial copy never replaces the destination.
+func replaceFile(src, dst string) error {
+	tmp := dst + ".swizzle"
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// copyFile copies a regular file, keeping the file mode.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,57 @@
+package swizzle
+
+import "errors"
+
+// ErrorCode is a machine readable swizzle error category.
+type ErrorCode string
+
+const (
+	// ErrCodeUnknown is for errors without a more specific category.
+	ErrCodeUnknown ErrorCode = "error"
+	// ErrCodeInvalidInput is for invalid user supplied values.
+	ErrCodeInvalidInput ErrorCode = "invalid_input"
+	// ErrCodeInvalidRepo is for repositories which cannot be read.
+	ErrCodeInvalidRepo ErrorCode = "invalid_repo"
+	// ErrCodeNotFound is for missing releases, manifests and release files.
+	ErrCodeNotFound ErrorCode = "not_found"
+	// ErrCodeIncompatible is for incompatible mod or game versions.
+	ErrCodeIncompatible ErrorCode = "incompatible"
+)
+
+// Error is a swizzle error with the repo and version the error applies to.
+type Error struct {
+	Code    ErrorCode
+	Repo    Repo
+	Version string
+	Err     error
+}
+
+// Error returns the error message.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError wraps err in a swizzle Error.
+func NewError(code ErrorCode, repo Repo, version string, err error) *Error {
+	return &Error{
+		Code:    code,
+		Repo:    repo,
+		Version: version,
+		Err:     err,
+	}
+}
+
+// ErrorCodeOf returns the ErrorCode for an error, or ErrCodeUnknown if the error
+// is not a swizzle Error.
+func ErrorCodeOf(err error) ErrorCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ErrCodeUnknown
+}
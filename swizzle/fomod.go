@@ -0,0 +1,537 @@
+package swizzle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// FomodConfigPath is the location of the FOMOD installer configuration inside
+// a mod archive.
+const FomodConfigPath string = "fomod/ModuleConfig.xml"
+
+// FomodGroupType is the selection rule for a FOMOD option group.
+type FomodGroupType string
+
+const (
+	SelectAtLeastOne FomodGroupType = "SelectAtLeastOne"
+	SelectAtMostOne  FomodGroupType = "SelectAtMostOne"
+	SelectExactlyOne FomodGroupType = "SelectExactlyOne"
+	SelectAll        FomodGroupType = "SelectAll"
+	SelectAny        FomodGroupType = "SelectAny"
+)
+
+// FomodPluginType is how a FOMOD option can be selected.
+type FomodPluginType string
+
+const (
+	// RequiredPlugin options are always selected.
+	RequiredPlugin FomodPluginType = "Required"
+	// RecommendedPlugin options are selected by default.
+	RecommendedPlugin FomodPluginType = "Recommended"
+	// OptionalPlugin options are not selected by default.
+	OptionalPlugin FomodPluginType = "Optional"
+	// NotUsablePlugin options cannot be selected.
+	NotUsablePlugin FomodPluginType = "NotUsable"
+	// CouldBeUsablePlugin options can be selected, but may not work.
+	CouldBeUsablePlugin FomodPluginType = "CouldBeUsable"
+)
+
+// FomodFileState is the state of a plugin file in the game, used by FOMOD
+// file dependencies.
+type FomodFileState string
+
+const (
+	FileActive   FomodFileState = "Active"
+	FileInactive FomodFileState = "Inactive"
+	FileMissing  FomodFileState = "Missing"
+)
+
+// FomodConfig is a parsed FOMOD ModuleConfig.xml installer.
+type FomodConfig struct {
+	XMLName                 xml.Name               `xml:"config"`
+	ModuleName              string                 `xml:"moduleName"`
+	ModuleDependencies      *FomodDependency       `xml:"moduleDependencies"`
+	RequiredInstallFiles    FomodFileList          `xml:"requiredInstallFiles"`
+	InstallSteps            FomodSteps             `xml:"installSteps"`
+	ConditionalFileInstalls []*FomodConditionFiles `xml:"conditionalFileInstalls>patterns>pattern"`
+}
+
+// FomodSteps is the ordered install steps in a FOMOD installer.
+type FomodSteps struct {
+	Order string       `xml:"order,attr"`
+	Steps []*FomodStep `xml:"installStep"`
+}
+
+// FomodStep is a page of option groups in a FOMOD installer.
+type FomodStep struct {
+	Name    string           `xml:"name,attr"`
+	Visible *FomodDependency `xml:"visible"`
+	Groups  struct {
+		Order  string        `xml:"order,attr"`
+		Groups []*FomodGroup `xml:"group"`
+	} `xml:"optionalFileGroups"`
+}
+
+// FomodGroup is a set of options with a selection rule.
+type FomodGroup struct {
+	Name    string         `xml:"name,attr"`
+	Type    FomodGroupType `xml:"type,attr"`
+	Plugins struct {
+		Order   string         `xml:"order,attr"`
+		Plugins []*FomodPlugin `xml:"plugin"`
+	} `xml:"plugins"`
+}
+
+// FomodPlugin is a single option in a FOMOD option group.
+type FomodPlugin struct {
+	Name        string `xml:"name,attr"`
+	Description string `xml:"description"`
+	Image       struct {
+		Path string `xml:"path,attr"`
+	} `xml:"image"`
+	Files          FomodFileList       `xml:"files"`
+	ConditionFlags []*FomodFlag        `xml:"conditionFlags>flag"`
+	TypeDescriptor FomodTypeDescriptor `xml:"typeDescriptor"`
+}
+
+// FomodFlag is a condition flag set when an option is selected.
+type FomodFlag struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+// FomodTypeDescriptor is the plugin type for an option, which is either fixed
+// or depends on flags and files.
+type FomodTypeDescriptor struct {
+	Type           *fomodType `xml:"type"`
+	DependencyType *struct {
+		DefaultType fomodType `xml:"defaultType"`
+		Patterns    []*struct {
+			Dependencies FomodDependency `xml:"dependencies"`
+			Type         fomodType       `xml:"type"`
+		} `xml:"patterns>pattern"`
+	} `xml:"dependencyType"`
+}
+
+type fomodType struct {
+	Name FomodPluginType `xml:"name,attr"`
+}
+
+// FomodFileList is the files and folders installed by a FOMOD option.
+type FomodFileList struct {
+	Items []*FomodFile `xml:",any"`
+}
+
+// FomodFile is a file or folder installed by a FOMOD installer.
+type FomodFile struct {
+	XMLName     xml.Name
+	Source      string  `xml:"source,attr"`
+	Destination *string `xml:"destination,attr"`
+	Priority    int     `xml:"priority,attr"`
+}
+
+// FomodConditionFiles is files installed when the dependencies are met after
+// all install steps.
+type FomodConditionFiles struct {
+	Dependencies FomodDependency `xml:"dependencies"`
+	Files        FomodFileList   `xml:"files"`
+}
+
+// FomodDependency is a flag, file, or game dependency, or a composite of
+// dependencies joined by an And or Or operator.
+type FomodDependency struct {
+	XMLName  xml.Name
+	Operator string             `xml:"operator,attr"`
+	Flag     string             `xml:"flag,attr"`
+	Value    string             `xml:"value,attr"`
+	File     string             `xml:"file,attr"`
+	State    FomodFileState     `xml:"state,attr"`
+	Items    []*FomodDependency `xml:",any"`
+}
+
+// ParseFomod parses a FOMOD ModuleConfig.xml, which may be UTF-8 or UTF-16
+// encoded.
+func ParseFomod(r io.Reader) (*FomodConfig, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	b = decodeUTF16(b)
+
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	// the content is UTF-8 after decoding, whatever the xml declaration says
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	var c FomodConfig
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("invalid FOMOD config: %s", err)
+	}
+	return &c, nil
+}
+
+// ReadFomod parses a FOMOD ModuleConfig.xml file.
+func ReadFomod(file string) (*FomodConfig, error) {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseFomod(f)
+}
+
+// decodeUTF16 converts UTF-16 content with a byte order mark to UTF-8, and
+// strips a UTF-8 byte order mark.
+func decodeUTF16(b []byte) []byte {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		order = binary.BigEndian
+	default:
+		return bytes.TrimPrefix(b, []byte{0xef, 0xbb, 0xbf})
+	}
+
+	b = b[2:]
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = order.Uint16(b[i*2:])
+	}
+	return []byte(string(utf16.Decode(u)))
+}
+
+// FomodOption is a FOMOD option with the plugin type resolved for the current
+// flags and files.
+type FomodOption struct {
+	*FomodPlugin
+	Type FomodPluginType `json:"type"`
+}
+
+// FomodSelector chooses the options for a group in a FOMOD install step. The
+// names of the selected options are returned.
+type FomodSelector interface {
+	SelectOptions(step *FomodStep, group *FomodGroup, options []*FomodOption) ([]string, error)
+}
+
+// FomodGroupChoice is the options selected for a FOMOD option group.
+type FomodGroupChoice struct {
+	Group   string   `json:"group" yaml:"group"`
+	Options []string `json:"options" yaml:"options"`
+}
+
+// FomodStepChoice is the options selected for every group in a FOMOD install
+// step.
+type FomodStepChoice struct {
+	Step   string              `json:"step" yaml:"step"`
+	Groups []*FomodGroupChoice `json:"groups" yaml:"groups"`
+}
+
+// FomodChoices is a selector which replays recorded FOMOD choices, matching
+// steps and groups by name. Groups without a recorded choice are passed to the
+// fallback selector, or are an error without one.
+type FomodChoices struct {
+	Choices  []*FomodStepChoice
+	Fallback FomodSelector
+}
+
+// SelectOptions returns the recorded options for a group.
+func (c FomodChoices) SelectOptions(step *FomodStep, group *FomodGroup, options []*FomodOption) ([]string, error) {
+	for _, s := range c.Choices {
+		if !strings.EqualFold(s.Step, step.Name) {
+			continue
+		}
+		for _, g := range s.Groups {
+			if strings.EqualFold(g.Group, group.Name) {
+				return g.Options, nil
+			}
+		}
+	}
+
+	if c.Fallback == nil {
+		return nil, NewError(ErrCodeNotFound, "", "", fmt.Errorf("no FOMOD choice recorded for group '%s' in step '%s'", group.Name, step.Name))
+	}
+	return c.Fallback.SelectOptions(step, group, options)
+}
+
+// FomodInstallFile is a file or folder to install, relative to the archive
+// source directory and the release file destination.
+type FomodInstallFile struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Folder      bool   `json:"folder"`
+	Priority    int    `json:"priority"`
+}
+
+// FomodInstall is the result of running a FOMOD installer.
+type FomodInstall struct {
+	Files   []*FomodInstallFile `json:"files"`
+	Choices []*FomodStepChoice  `json:"choices"`
+	Flags   map[string]string   `json:"flags"`
+}
+
+// DefaultFomodSelector selects required and recommended options, and the
+// first usable option when a group needs at least one.
+type DefaultFomodSelector struct{}
+
+// SelectOptions selects the default options for a group.
+func (DefaultFomodSelector) SelectOptions(step *FomodStep, group *FomodGroup, options []*FomodOption) ([]string, error) {
+	var selected []string
+	firstUsable := ""
+	for _, o := range options {
+		if o.Type == NotUsablePlugin {
+			continue
+		}
+		if firstUsable == "" {
+			firstUsable = o.Name
+		}
+		if group.Type == SelectAll || o.Type == RequiredPlugin || o.Type == RecommendedPlugin {
+			selected = append(selected, o.Name)
+		}
+	}
+
+	switch group.Type {
+	case SelectExactlyOne, SelectAtMostOne:
+		if len(selected) > 1 {
+			selected = selected[:1]
+		}
+		if len(selected) == 0 && group.Type == SelectExactlyOne && firstUsable != "" {
+			selected = []string{firstUsable}
+		}
+	case SelectAtLeastOne:
+		if len(selected) == 0 && firstUsable != "" {
+			selected = []string{firstUsable}
+		}
+	}
+	return selected, nil
+}
+
+// Install runs the installer: required files are always installed, every
+// visible step asks the selector for the options in each group, and
+// conditional files are added for the flags set by the selected options.
+// fileState reports the state of plugin files for file dependencies.
+func (c *FomodConfig) Install(sel FomodSelector, fileState func(string) FomodFileState) (*FomodInstall, error) {
+	inst := &FomodInstall{Flags: map[string]string{}}
+	if fileState == nil {
+		fileState = func(string) FomodFileState { return FileMissing }
+	}
+
+	if c.ModuleDependencies != nil && !c.ModuleDependencies.met(inst.Flags, fileState) {
+		return nil, NewError(ErrCodeIncompatible, "", "", fmt.Errorf("'%s' requirements are not met by the installed plugins", c.ModuleName))
+	}
+
+	inst.add(c.RequiredInstallFiles)
+
+	steps := c.InstallSteps.Steps
+	sortFomod(c.InstallSteps.Order, len(steps), func(i int) string { return steps[i].Name }, func(i, j int) {
+		steps[i], steps[j] = steps[j], steps[i]
+	})
+
+	for _, step := range steps {
+		if step.Visible != nil && !step.Visible.met(inst.Flags, fileState) {
+			continue
+		}
+
+		choice := &FomodStepChoice{Step: step.Name}
+		groups := step.Groups.Groups
+		sortFomod(step.Groups.Order, len(groups), func(i int) string { return groups[i].Name }, func(i, j int) {
+			groups[i], groups[j] = groups[j], groups[i]
+		})
+
+		for _, group := range groups {
+			plugins := group.Plugins.Plugins
+			sortFomod(group.Plugins.Order, len(plugins), func(i int) string { return plugins[i].Name }, func(i, j int) {
+				plugins[i], plugins[j] = plugins[j], plugins[i]
+			})
+
+			options := make([]*FomodOption, len(plugins))
+			for i, p := range plugins {
+				options[i] = &FomodOption{FomodPlugin: p, Type: p.TypeDescriptor.resolve(inst.Flags, fileState)}
+			}
+
+			names, err := sel.SelectOptions(step, group, options)
+			if err != nil {
+				return nil, err
+			}
+			selected, err := validateFomodSelection(step, group, options, names)
+			if err != nil {
+				return nil, err
+			}
+
+			gc := &FomodGroupChoice{Group: group.Name, Options: []string{}}
+			for _, o := range selected {
+				gc.Options = append(gc.Options, o.Name)
+				for _, f := range o.ConditionFlags {
+					inst.Flags[f.Name] = f.Value
+				}
+				inst.add(o.Files)
+			}
+			choice.Groups = append(choice.Groups, gc)
+		}
+		inst.Choices = append(inst.Choices, choice)
+	}
+
+	for _, cf := range c.ConditionalFileInstalls {
+		if cf.Dependencies.met(inst.Flags, fileState) {
+			inst.add(cf.Files)
+		}
+	}
+
+	// files with a higher priority are installed last so they overwrite
+	// files with a lower priority
+	sort.SliceStable(inst.Files, func(i, j int) bool {
+		return inst.Files[i].Priority < inst.Files[j].Priority
+	})
+	return inst, nil
+}
+
+// add appends the files and folders in a file list to the install.
+func (inst *FomodInstall) add(files FomodFileList) {
+	for _, f := range files.Items {
+		folder := f.XMLName.Local == "folder"
+		if !folder && f.XMLName.Local != "file" {
+			continue
+		}
+
+		// a missing destination is the same as the source, and an empty
+		// destination is the root of the install
+		src := cleanPath(f.Source)
+		dst := src
+		if f.Destination != nil {
+			dst = cleanPath(*f.Destination)
+			if dst == "" && !folder {
+				dst = path.Base(src)
+			}
+		}
+
+		inst.Files = append(inst.Files, &FomodInstallFile{
+			Source:      src,
+			Destination: dst,
+			Folder:      folder,
+			Priority:    f.Priority,
+		})
+	}
+}
+
+// validateFomodSelection checks the selected option names against the group
+// type and option types, and returns the selected options. Required options
+// are always included.
+func validateFomodSelection(step *FomodStep, group *FomodGroup, options []*FomodOption, names []string) ([]*FomodOption, error) {
+	chosen := map[string]bool{}
+	for _, n := range names {
+		chosen[strings.ToLower(n)] = true
+	}
+
+	var selected []*FomodOption
+	found := 0
+	for _, o := range options {
+		key := strings.ToLower(o.Name)
+		if chosen[key] {
+			found++
+		}
+		if !chosen[key] && o.Type != RequiredPlugin && group.Type != SelectAll {
+			continue
+		}
+		if o.Type == NotUsablePlugin {
+			return nil, NewError(ErrCodeInvalidInput, "", "", fmt.Errorf("option '%s' in '%s' cannot be selected", o.Name, group.Name))
+		}
+		selected = append(selected, o)
+	}
+	if found < len(chosen) {
+		return nil, NewError(ErrCodeInvalidInput, "", "", fmt.Errorf("unknown option for '%s' in step '%s': %s", group.Name, step.Name, strings.Join(names, ", ")))
+	}
+
+	n := len(selected)
+	valid := true
+	switch group.Type {
+	case SelectExactlyOne:
+		valid = n == 1
+	case SelectAtMostOne:
+		valid = n <= 1
+	case SelectAtLeastOne:
+		valid = n >= 1
+	}
+	if !valid {
+		return nil, NewError(ErrCodeInvalidInput, "", "", fmt.Errorf("'%s' in step '%s' is %s, but %d options are selected", group.Name, step.Name, group.Type, n))
+	}
+	return selected, nil
+}
+
+// resolve returns the plugin type for the current flags and files.
+func (t FomodTypeDescriptor) resolve(flags map[string]string, fileState func(string) FomodFileState) FomodPluginType {
+	if t.DependencyType != nil {
+		for _, p := range t.DependencyType.Patterns {
+			if p.Dependencies.met(flags, fileState) {
+				return p.Type.Name
+			}
+		}
+		return t.DependencyType.DefaultType.Name
+	}
+	if t.Type != nil && t.Type.Name != "" {
+		return t.Type.Name
+	}
+	return OptionalPlugin
+}
+
+// met checks whether the dependency is satisfied. Game and mod manager
+// version dependencies are always met.
+func (d *FomodDependency) met(flags map[string]string, fileState func(string) FomodFileState) bool {
+	switch d.XMLName.Local {
+	case "flagDependency":
+		return flags[d.Flag] == d.Value
+	case "fileDependency":
+		return fileState(d.File) == d.State
+	case "gameDependency", "fommDependency", "foseDependency", "fomodDependency":
+		return true
+	}
+
+	// composite dependency
+	or := strings.EqualFold(d.Operator, "Or")
+	for _, item := range d.Items {
+		ok := item.met(flags, fileState)
+		if or && ok {
+			return true
+		}
+		if !or && !ok {
+			return false
+		}
+	}
+	return !or || len(d.Items) == 0
+}
+
+// sortFomod orders steps, groups, or plugins by the FOMOD order attribute,
+// which defaults to Ascending. Explicit keeps the document order.
+func sortFomod(order string, n int, name func(int) string, swap func(i, j int)) {
+	if strings.EqualFold(order, "Explicit") {
+		return
+	}
+	desc := strings.EqualFold(order, "Descending")
+	sort.Stable(fomodSorter{n, name, swap, desc})
+}
+
+type fomodSorter struct {
+	n    int
+	name func(int) string
+	swap func(i, j int)
+	desc bool
+}
+
+func (s fomodSorter) Len() int      { return s.n }
+func (s fomodSorter) Swap(i, j int) { s.swap(i, j) }
+func (s fomodSorter) Less(i, j int) bool {
+	if s.desc {
+		return strings.ToLower(s.name(i)) > strings.ToLower(s.name(j))
+	}
+	return strings.ToLower(s.name(i)) < strings.ToLower(s.name(j))
+}
@@ -0,0 +1,387 @@
+package swizzle
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testFomodConfig = `<?xml version="1.0" encoding="utf-8"?>
+<config>
+	<moduleName>Test</moduleName>
+	<requiredInstallFiles>
+		<file source="core\main.esp"/>
+	</requiredInstallFiles>
+	<installSteps order="Explicit">
+		<installStep name="Textures">
+			<optionalFileGroups order="Explicit">
+				<group name="Resolution" type="SelectExactlyOne">
+					<plugins order="Ascending">
+						<plugin name="4K">
+							<description/>
+							<files><folder source="tex4k" destination="textures"/></files>
+							<conditionFlags><flag name="res">4k</flag></conditionFlags>
+							<typeDescriptor><type name="Optional"/></typeDescriptor>
+						</plugin>
+						<plugin name="2K">
+							<description/>
+							<files><folder source="tex2k" destination="textures"/></files>
+							<conditionFlags><flag name="res">2k</flag></conditionFlags>
+							<typeDescriptor><type name="Recommended"/></typeDescriptor>
+						</plugin>
+					</plugins>
+				</group>
+			</optionalFileGroups>
+		</installStep>
+		<installStep name="Extras">
+			<visible><flagDependency flag="res" value="4k"/></visible>
+			<optionalFileGroups>
+				<group name="Extra" type="SelectAny">
+					<plugins>
+						<plugin name="Parallax">
+							<description/>
+							<files><file source="extra\p.esp" destination="p.esp" priority="1"/></files>
+							<typeDescriptor><type name="Optional"/></typeDescriptor>
+						</plugin>
+					</plugins>
+				</group>
+			</optionalFileGroups>
+		</installStep>
+		<installStep name="Patches">
+			<optionalFileGroups>
+				<group name="Patches" type="SelectAny">
+					<plugins>
+						<plugin name="USSEP Patch">
+							<description/>
+							<files><file source="patch\ussep.esp" destination=""/></files>
+							<typeDescriptor>
+								<dependencyType>
+									<defaultType name="Optional"/>
+									<patterns>
+										<pattern>
+											<dependencies><fileDependency file="Unofficial Skyrim Special Edition Patch.esp" state="Active"/></dependencies>
+											<type name="Recommended"/>
+										</pattern>
+									</patterns>
+								</dependencyType>
+							</typeDescriptor>
+						</plugin>
+					</plugins>
+				</group>
+			</optionalFileGroups>
+		</installStep>
+	</installSteps>
+	<conditionalFileInstalls>
+		<patterns>
+			<pattern>
+				<dependencies operator="And"><flagDependency flag="res" value="2k"/></dependencies>
+				<files><file source="lod\2k.bsa" destination="lod.bsa"/></files>
+			</pattern>
+		</patterns>
+	</conditionalFileInstalls>
+</config>`
+
+// activeFiles returns a file state function with the named plugins active.
+func activeFiles(names ...string) func(string) FomodFileState {
+	return func(file string) FomodFileState {
+		for _, n := range names {
+			if strings.EqualFold(n, file) {
+				return FileActive
+			}
+		}
+		return FileMissing
+	}
+}
+
+func TestFomodInstall(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		sel       FomodSelector
+		fileState func(string) FomodFileState
+		files     []*FomodInstallFile
+		choices   []*FomodStepChoice
+		err       string
+	}{
+		{
+			name:   "default options",
+			config: testFomodConfig,
+			sel:    DefaultFomodSelector{},
+			files: []*FomodInstallFile{
+				{Source: "core/main.esp", Destination: "core/main.esp"},
+				{Source: "tex2k", Destination: "textures", Folder: true},
+				{Source: "lod/2k.bsa", Destination: "lod.bsa"},
+			},
+			choices: []*FomodStepChoice{
+				{Step: "Textures", Groups: []*FomodGroupChoice{{Group: "Resolution", Options: []string{"2K"}}}},
+				{Step: "Patches", Groups: []*FomodGroupChoice{{Group: "Patches", Options: []string{}}}},
+			},
+		},
+		{
+			name:      "file dependencies change the default options",
+			config:    testFomodConfig,
+			sel:       DefaultFomodSelector{},
+			fileState: activeFiles("unofficial skyrim special edition patch.esp"),
+			files: []*FomodInstallFile{
+				{Source: "core/main.esp", Destination: "core/main.esp"},
+				{Source: "tex2k", Destination: "textures", Folder: true},
+				{Source: "patch/ussep.esp", Destination: "ussep.esp"},
+				{Source: "lod/2k.bsa", Destination: "lod.bsa"},
+			},
+			choices: []*FomodStepChoice{
+				{Step: "Textures", Groups: []*FomodGroupChoice{{Group: "Resolution", Options: []string{"2K"}}}},
+				{Step: "Patches", Groups: []*FomodGroupChoice{{Group: "Patches", Options: []string{"USSEP Patch"}}}},
+			},
+		},
+		{
+			name:   "recorded choices show steps for flags and order files by priority",
+			config: testFomodConfig,
+			sel: FomodChoices{Choices: []*FomodStepChoice{
+				{Step: "textures", Groups: []*FomodGroupChoice{{Group: "resolution", Options: []string{"4k"}}}},
+				{Step: "Extras", Groups: []*FomodGroupChoice{{Group: "Extra", Options: []string{"Parallax"}}}},
+				{Step: "Patches", Groups: []*FomodGroupChoice{{Group: "Patches", Options: []string{"USSEP Patch"}}}},
+			}},
+			files: []*FomodInstallFile{
+				{Source: "core/main.esp", Destination: "core/main.esp"},
+				{Source: "tex4k", Destination: "textures", Folder: true},
+				{Source: "patch/ussep.esp", Destination: "ussep.esp"},
+				{Source: "extra/p.esp", Destination: "p.esp", Priority: 1},
+			},
+			choices: []*FomodStepChoice{
+				{Step: "Textures", Groups: []*FomodGroupChoice{{Group: "Resolution", Options: []string{"4K"}}}},
+				{Step: "Extras", Groups: []*FomodGroupChoice{{Group: "Extra", Options: []string{"Parallax"}}}},
+				{Step: "Patches", Groups: []*FomodGroupChoice{{Group: "Patches", Options: []string{"USSEP Patch"}}}},
+			},
+		},
+		{
+			name:   "recorded choices without a fallback",
+			config: testFomodConfig,
+			sel: FomodChoices{Choices: []*FomodStepChoice{
+				{Step: "Textures", Groups: []*FomodGroupChoice{{Group: "Resolution", Options: []string{"2K"}}}},
+			}},
+			err: "no FOMOD choice recorded for group 'Patches' in step 'Patches'",
+		},
+		{
+			name:   "recorded choices with a fallback",
+			config: testFomodConfig,
+			sel: FomodChoices{
+				Choices: []*FomodStepChoice{
+					{Step: "Textures", Groups: []*FomodGroupChoice{{Group: "Resolution", Options: []string{"4K"}}}},
+				},
+				Fallback: DefaultFomodSelector{},
+			},
+			files: []*FomodInstallFile{
+				{Source: "core/main.esp", Destination: "core/main.esp"},
+				{Source: "tex4k", Destination: "textures", Folder: true},
+			},
+			choices: []*FomodStepChoice{
+				{Step: "Textures", Groups: []*FomodGroupChoice{{Group: "Resolution", Options: []string{"4K"}}}},
+				{Step: "Extras", Groups: []*FomodGroupChoice{{Group: "Extra", Options: []string{}}}},
+				{Step: "Patches", Groups: []*FomodGroupChoice{{Group: "Patches", Options: []string{}}}},
+			},
+		},
+		{
+			name:   "too many options for the group type",
+			config: testFomodConfig,
+			sel: FomodChoices{Choices: []*FomodStepChoice{
+				{Step: "Textures", Groups: []*FomodGroupChoice{{Group: "Resolution", Options: []string{"2K", "4K"}}}},
+			}},
+			err: "'Resolution' in step 'Textures' is SelectExactlyOne, but 2 options are selected",
+		},
+		{
+			name: "module dependencies not met",
+			config: `<config>
+				<moduleName>Needs Skyrim</moduleName>
+				<moduleDependencies operator="And"><fileDependency file="Skyrim.esm" state="Active"/></moduleDependencies>
+			</config>`,
+			sel: DefaultFomodSelector{},
+			err: "'Needs Skyrim' requirements are not met",
+		},
+		{
+			name: "module dependencies met",
+			config: `<config>
+				<moduleName>Needs Skyrim</moduleName>
+				<moduleDependencies operator="And"><fileDependency file="Skyrim.esm" state="Active"/></moduleDependencies>
+				<requiredInstallFiles><folder source="data" destination=""/></requiredInstallFiles>
+			</config>`,
+			sel:       DefaultFomodSelector{},
+			fileState: activeFiles("Skyrim.esm"),
+			files:     []*FomodInstallFile{{Source: "data", Destination: "", Folder: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseFomod(strings.NewReader(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			inst, err := c.Install(tt.sel, tt.fileState)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(inst.Files, tt.files) {
+				t.Errorf("files:")
+				for _, f := range inst.Files {
+					t.Errorf("  got %+v", f)
+				}
+				for _, f := range tt.files {
+					t.Errorf("  want %+v", f)
+				}
+			}
+			if !reflect.DeepEqual(inst.Choices, tt.choices) {
+				t.Errorf("choices:")
+				for _, s := range inst.Choices {
+					for _, g := range s.Groups {
+						t.Errorf("  got %s/%s %v", s.Step, g.Group, g.Options)
+					}
+				}
+				for _, s := range tt.choices {
+					for _, g := range s.Groups {
+						t.Errorf("  want %s/%s %v", s.Step, g.Group, g.Options)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestValidateFomodSelection(t *testing.T) {
+	options := func(types ...FomodPluginType) []*FomodOption {
+		var opts []*FomodOption
+		for i, typ := range types {
+			opts = append(opts, &FomodOption{FomodPlugin: &FomodPlugin{Name: string(rune('A' + i))}, Type: typ})
+		}
+		return opts
+	}
+
+	tests := []struct {
+		name      string
+		groupType FomodGroupType
+		options   []*FomodOption
+		names     []string
+		want      []string
+		err       string
+	}{
+		{"exactly one", SelectExactlyOne, options(OptionalPlugin, OptionalPlugin), []string{"b"}, []string{"B"}, ""},
+		{"exactly one with none", SelectExactlyOne, options(OptionalPlugin, OptionalPlugin), nil, nil, "0 options are selected"},
+		{"exactly one with two", SelectExactlyOne, options(OptionalPlugin, OptionalPlugin), []string{"A", "B"}, nil, "2 options are selected"},
+		{"at most one with none", SelectAtMostOne, options(OptionalPlugin, OptionalPlugin), nil, nil, ""},
+		{"at most one with two", SelectAtMostOne, options(OptionalPlugin, OptionalPlugin), []string{"A", "B"}, nil, "2 options are selected"},
+		{"at least one with none", SelectAtLeastOne, options(OptionalPlugin), nil, nil, "0 options are selected"},
+		{"at least one with two", SelectAtLeastOne, options(OptionalPlugin, OptionalPlugin), []string{"A", "B"}, []string{"A", "B"}, ""},
+		{"select all", SelectAll, options(OptionalPlugin, OptionalPlugin), nil, []string{"A", "B"}, ""},
+		{"required options are always selected", SelectAny, options(RequiredPlugin, OptionalPlugin), []string{"B"}, []string{"A", "B"}, ""},
+		{"required options count for the group type", SelectExactlyOne, options(RequiredPlugin, OptionalPlugin), []string{"B"}, nil, "2 options are selected"},
+		{"not usable option", SelectAny, options(NotUsablePlugin), []string{"A"}, nil, "option 'A' in 'G' cannot be selected"},
+		{"unknown option", SelectAny, options(OptionalPlugin), []string{"Z"}, nil, "unknown option for 'G' in step 'S': Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := &FomodStep{Name: "S"}
+			group := &FomodGroup{Name: "G", Type: tt.groupType}
+			selected, err := validateFomodSelection(step, group, tt.options, tt.names)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				if ErrorCodeOf(err) != ErrCodeInvalidInput {
+					t.Errorf("expected error code %v, got %v", ErrCodeInvalidInput, ErrorCodeOf(err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, o := range selected {
+				names = append(names, o.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortFomod(t *testing.T) {
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{"", []string{"a", "B", "c"}},
+		{"Ascending", []string{"a", "B", "c"}},
+		{"descending", []string{"c", "B", "a"}},
+		{"Explicit", []string{"c", "a", "B"}},
+	}
+
+	for _, tt := range tests {
+		names := []string{"c", "a", "B"}
+		sortFomod(tt.order, len(names), func(i int) string { return names[i] }, func(i, j int) {
+			names[i], names[j] = names[j], names[i]
+		})
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("order %q: got %v, want %v", tt.order, names, tt.want)
+		}
+	}
+}
+
+func TestFomodDependencyMet(t *testing.T) {
+	flag := func(name, value string) *FomodDependency {
+		d := &FomodDependency{Flag: name, Value: value}
+		d.XMLName.Local = "flagDependency"
+		return d
+	}
+	file := func(name string, state FomodFileState) *FomodDependency {
+		d := &FomodDependency{File: name, State: state}
+		d.XMLName.Local = "fileDependency"
+		return d
+	}
+	composite := func(op string, items ...*FomodDependency) *FomodDependency {
+		d := &FomodDependency{Operator: op, Items: items}
+		d.XMLName.Local = "dependencies"
+		return d
+	}
+	game := &FomodDependency{}
+	game.XMLName.Local = "gameDependency"
+
+	flags := map[string]string{"a": "on", "b": ""}
+	fileState := activeFiles("Skyrim.esm")
+
+	tests := []struct {
+		name string
+		dep  *FomodDependency
+		met  bool
+	}{
+		{"flag set", flag("a", "on"), true},
+		{"flag value differs", flag("a", "off"), false},
+		{"flag unset", flag("c", ""), true},
+		{"active file", file("skyrim.esm", FileActive), true},
+		{"missing file", file("Dawnguard.esm", FileMissing), true},
+		{"file state differs", file("Dawnguard.esm", FileActive), false},
+		{"game version", game, true},
+		{"and", composite("And", flag("a", "on"), file("Skyrim.esm", FileActive)), true},
+		{"and with one unmet", composite("And", flag("a", "on"), flag("a", "off")), false},
+		{"default operator is and", composite("", flag("a", "on"), flag("a", "off")), false},
+		{"or", composite("Or", flag("a", "off"), flag("a", "on")), true},
+		{"or with none met", composite("or", flag("a", "off"), flag("b", "on")), false},
+		{"empty or", composite("Or"), true},
+		{"nested", composite("Or", composite("And", flag("a", "on"), flag("b", "on")), game), true},
+	}
+
+	for _, tt := range tests {
+		if met := tt.dep.met(flags, fileState); met != tt.met {
+			t.Errorf("%s: got %v, want %v", tt.name, met, tt.met)
+		}
+	}
+}
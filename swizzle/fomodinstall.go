@@ -0,0 +1,183 @@
+package swizzle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StageOption configures how a mod release is staged.
+type StageOption func(*stageOptions)
+
+// stageOptions is the set of options for staging a mod release.
+type stageOptions struct {
+	selector  func(m *Manifest, f *ReleaseFile) FomodSelector
+	fileState func(string) FomodFileState
+}
+
+// WithFomodSelector sets the function which returns the selector for FOMOD
+// options in each release file. Without this option the default FOMOD options
+// are installed, and groups missing from recorded choices are an error.
+func WithFomodSelector(fn func(m *Manifest, f *ReleaseFile) FomodSelector) StageOption {
+	return func(o *stageOptions) {
+		o.selector = fn
+	}
+}
+
+// WithFileState sets the function which reports the state of plugin files for
+// FOMOD file dependencies. Without this option every plugin is missing.
+func WithFileState(fn func(string) FomodFileState) StageOption {
+	return func(o *stageOptions) {
+		o.fileState = fn
+	}
+}
+
+// FomodFileStates returns a file state function for a load order. Enabled
+// plugins are active, and disabled plugins are inactive.
+func FomodFileStates(lo *LoadOrder) func(string) FomodFileState {
+	states := map[string]FomodFileState{}
+	for _, p := range lo.Plugins {
+		state := FileInactive
+		if p.Enabled {
+			state = FileActive
+		}
+		states[strings.ToLower(p.Name)] = state
+	}
+
+	return func(file string) FomodFileState {
+		if state, ok := states[strings.ToLower(filepath.Base(cleanPath(file)))]; ok {
+			return state
+		}
+		return FileMissing
+	}
+}
+
+// fomodConfigName returns the archive path of the FOMOD config in the archive
+// source directory, or an empty string when the archive has no FOMOD installer.
+func fomodConfigName(a Archive, source string) (string, error) {
+	files, err := a.List(source)
+	if err != nil {
+		return "", err
+	}
+	for _, af := range files {
+		if lowerPath(af.Name) == strings.ToLower(FomodConfigPath) {
+			return af.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// ReadArchiveFomod reads the FOMOD installer config from the source directory
+// of an archive.
+func ReadArchiveFomod(a Archive, source string) (*FomodConfig, error) {
+	config, err := fomodConfigName(a, source)
+	if err != nil {
+		return nil, err
+	}
+	if config == "" {
+		return nil, NewError(ErrCodeNotFound, "", "", fmt.Errorf("'%s' has no FOMOD installer", filepath.Base(a.Location())))
+	}
+
+	tmp, err := os.MkdirTemp("", "swizzle-fomod-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := a.Unpack(tmp, source, OnlyFiles(config)); err != nil {
+		return nil, err
+	}
+	return ReadFomod(filepath.Join(tmp, filepath.FromSlash(config)))
+}
+
+// fomodSelector returns the selector for the FOMOD options in a release file.
+// Recorded choices are replayed, and groups missing from the choices are only
+// prompted for with a selector option, otherwise they are an error so
+// non-interactive installs are reproducible.
+func (o *stageOptions) fomodSelector(m *Manifest, f *ReleaseFile) FomodSelector {
+	if len(f.Choices) > 0 {
+		c := FomodChoices{Choices: f.Choices}
+		if o.selector != nil {
+			c.Fallback = o.selector(m, f)
+		}
+		return c
+	}
+	if o.selector != nil {
+		return o.selector(m, f)
+	}
+	return DefaultFomodSelector{}
+}
+
+// installFomod extracts the release file to the extract directory, runs the
+// FOMOD installer, and copies the selected files to dst. The selected options
+// are returned. Copying stops when the context is canceled.
+func (o *stageOptions) installFomod(ctx context.Context, m *Manifest, f *ReleaseFile, config, extract, dst string) ([]*FomodStepChoice, error) {
+	if err := f.archive.Unpack(extract, f.Source, WithContext(ctx)); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(extract)
+
+	c, err := ReadFomod(filepath.Join(extract, filepath.FromSlash(config)))
+	if err != nil {
+		return nil, err
+	}
+
+	inst, err := c.Install(o.fomodSelector(m, f), o.fileState)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return nil, err
+	}
+	src := newCaseResolver(extract)
+	out := newCaseResolver(dst)
+	for _, file := range inst.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		from := src.Resolve(file.Source)
+		info, err := os.Stat(from)
+		if err != nil {
+			return nil, fmt.Errorf("FOMOD file '%s' is missing from the archive", file.Source)
+		}
+
+		if !file.Folder || !info.IsDir() {
+			if err := copyStagedFile(from, out.Resolve(file.Destination)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		err = filepath.WalkDir(from, func(p string, e os.DirEntry, err error) error {
+			if err != nil || e.IsDir() {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(from, p)
+			if err != nil {
+				return err
+			}
+			to := out.Resolve(filepath.ToSlash(filepath.Join(filepath.FromSlash(file.Destination), rel)))
+			return copyStagedFile(p, to)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return inst.Choices, nil
+}
+
+// copyStagedFile copies an extracted file to the staging directory, creating
+// missing parent directories and replacing any existing file.
+func copyStagedFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return copyFile(src, dst)
+}
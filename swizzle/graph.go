@@ -0,0 +1,237 @@
+package swizzle
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/afloesch/semver"
+)
+
+// GraphNode is a single mod in a resolved dependency graph.
+type GraphNode struct {
+	// ID is the unique node identifier, which is the repo name for all
+	// dependencies.
+	ID string `json:"id"`
+
+	// Name is the display name of the mod.
+	Name string `json:"name"`
+
+	// Repo is the GitHub repository for the mod. The root manifest may not
+	// have a repository.
+	Repo Repo `json:"repo,omitempty"`
+
+	// Version is the resolved release version of the mod.
+	Version semver.String `json:"version,omitempty"`
+
+	// Game is the supported game and game version declared by the mod.
+	Game Game `json:"game,omitempty"`
+
+	// Compatible is false when the mod game does not match the root
+	// manifest game.
+	Compatible bool `json:"compatible"`
+
+	manifest *Manifest
+}
+
+// Manifest returns the resolved manifest for the node.
+func (n *GraphNode) Manifest() *Manifest {
+	return n.manifest
+}
+
+// GraphEdge is a dependency from one mod to another.
+type GraphEdge struct {
+	From       string        `json:"from"`
+	To         string        `json:"to"`
+	Constraint semver.String `json:"constraint"`
+}
+
+// Graph is the resolved dependency graph for a manifest.
+type Graph struct {
+	Root  *GraphNode   `json:"root"`
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []*GraphEdge `json:"edges"`
+}
+
+// Graph resolves the release manifest for every dependency of the manifest,
+// and all of their dependencies, and returns the dependency graph.
+func (m *Manifest) Graph(ctx context.Context) (*Graph, error) {
+	return m.graph(func(repo Repo, ver semver.String) (*Manifest, error) {
+		rel, err := repo.Release(ctx, string(ver))
+		if err != nil {
+			return nil, err
+		}
+		return repo.Manifest(ctx, rel)
+	})
+}
+
+// graph returns the dependency graph for the manifest, with the release
+// manifest for each dependency returned by resolve.
+func (m *Manifest) graph(resolve func(Repo, semver.String) (*Manifest, error)) (*Graph, error) {
+	root := &GraphNode{
+		ID:         m.nodeID(),
+		Name:       m.displayName(),
+		Repo:       m.Repo,
+		Version:    m.Version,
+		Game:       m.Game,
+		Compatible: true,
+		manifest:   m,
+	}
+
+	g := &Graph{
+		Root:  root,
+		Nodes: []*GraphNode{root},
+	}
+
+	visited := map[string]*GraphNode{root.ID: root}
+	queue := []*GraphNode{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		for _, repo := range node.manifest.sortedDependencies() {
+			ver := node.manifest.Dependency[repo]
+			g.Edges = append(g.Edges, &GraphEdge{
+				From:       node.ID,
+				To:         repo.String(),
+				Constraint: ver,
+			})
+
+			if _, ok := visited[repo.String()]; ok {
+				continue
+			}
+
+			dep, err := resolve(repo, ver)
+			if err != nil {
+				return nil, fmt.Errorf("'%s': %w", repo, err)
+			}
+
+			child := &GraphNode{
+				ID:         repo.String(),
+				Name:       dep.displayName(),
+				Repo:       repo,
+				Version:    dep.Version,
+				Game:       dep.Game,
+				Compatible: m.Game.Compatible(dep.Game),
+				manifest:   dep,
+			}
+			visited[child.ID] = child
+			g.Nodes = append(g.Nodes, child)
+			queue = append(queue, child)
+		}
+	}
+
+	return g, nil
+}
+
+// dependencies returns the dependencies of a mod release from its release
+// manifest in the graph. False is returned when the graph is nil or does not
+// include the release.
+func (g *Graph) dependencies(mod *LockedMod) ([]Repo, bool) {
+	if g == nil {
+		return nil, false
+	}
+	for _, n := range g.Nodes {
+		if n.Repo == mod.Repo && n.Version == mod.Version && n.manifest != nil {
+			return n.manifest.sortedDependencies(), true
+		}
+	}
+	return nil, false
+}
+
+// DOT renders the graph in the Graphviz DOT language. Nodes with a game
+// incompatible with the root manifest are highlighted.
+func (g *Graph) DOT() string {
+	var s strings.Builder
+	s.WriteString("digraph swizzle {\n")
+	s.WriteString("  node [shape=box];\n")
+	for _, n := range g.Nodes {
+		attrs := fmt.Sprintf("label=%q", n.label())
+		if !n.Compatible {
+			attrs += ", color=red, fontcolor=red"
+		}
+		s.WriteString(fmt.Sprintf("  %q [%s];\n", n.ID, attrs))
+	}
+	for _, e := range g.Edges {
+		s.WriteString(fmt.Sprintf("  %q -> %q [label=%q];\n", e.From, e.To, string(e.Constraint)))
+	}
+	s.WriteString("}\n")
+	return s.String()
+}
+
+// Mermaid renders the graph as a Mermaid flowchart. Nodes with a game
+// incompatible with the root manifest are highlighted.
+func (g *Graph) Mermaid() string {
+	ids := map[string]string{}
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+	}
+
+	var s strings.Builder
+	s.WriteString("graph TD\n")
+	for _, n := range g.Nodes {
+		label := strings.ReplaceAll(n.label(), "\"", "#quot;")
+		label = strings.ReplaceAll(label, "\n", "<br/>")
+		s.WriteString(fmt.Sprintf("  %s[\"%s\"]\n", ids[n.ID], label))
+	}
+	for _, e := range g.Edges {
+		label := strings.ReplaceAll(string(e.Constraint), "\"", "#quot;")
+		s.WriteString(fmt.Sprintf("  %s -->|\"%s\"| %s\n", ids[e.From], label, ids[e.To]))
+	}
+
+	var incompatible []string
+	for _, n := range g.Nodes {
+		if !n.Compatible {
+			incompatible = append(incompatible, ids[n.ID])
+		}
+	}
+	if len(incompatible) > 0 {
+		s.WriteString("  classDef incompatible fill:#fdd,stroke:#d00,color:#d00\n")
+		s.WriteString(fmt.Sprintf("  class %s incompatible\n", strings.Join(incompatible, ",")))
+	}
+	return s.String()
+}
+
+// label returns the display label for the node.
+func (n *GraphNode) label() string {
+	l := n.Name
+	if n.Version != "" {
+		l = fmt.Sprintf("%s\n%s", l, n.Version)
+	}
+	if n.Game.Version != "" {
+		l = fmt.Sprintf("%s\ngame %s", l, n.Game.Version)
+	}
+	return l
+}
+
+// nodeID returns the graph node identifier for the manifest.
+func (m *Manifest) nodeID() string {
+	if m.Repo != "" {
+		return m.Repo.String()
+	}
+	return m.displayName()
+}
+
+// displayName returns the mod name, or the repo name if no name is set.
+func (m *Manifest) displayName() string {
+	if m.Name != "" {
+		return m.Name
+	}
+	if m.Repo != "" {
+		return m.Repo.Name()
+	}
+	return "root"
+}
+
+// sortedDependencies returns the manifest dependencies in a stable order.
+func (m *Manifest) sortedDependencies() []Repo {
+	repos := make([]Repo, 0, len(m.Dependency))
+	for k := range m.Dependency {
+		repos = append(repos, k)
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i] < repos[j]
+	})
+	return repos
+}
@@ -0,0 +1,444 @@
+package swizzle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// INITweak is a value set in an INI file when a mod is deployed, and reverted
+// when the mod is removed.
+type INITweak struct {
+	// File is the INI file path, relative to the install root.
+	File string `json:"file" yaml:"file"`
+
+	// Root is the base directory the file is relative to. One of game,
+	// documents, or appdata. Default is the game directory.
+	Root InstallRoot `json:"root,omitempty" yaml:"root,omitempty"`
+
+	// Section is the INI section name, without brackets. An empty section
+	// is the top of the file before any section.
+	Section string `json:"section" yaml:"section"`
+
+	Key   string `json:"key" yaml:"key"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// INISetting is an INI tweak from a mod in a deploy plan.
+type INISetting struct {
+	INITweak
+
+	// Repo is the mod setting the value, empty for the root manifest.
+	Repo Repo `json:"repo,omitempty"`
+}
+
+// INIConflict is an INI key set to different values by more than one mod.
+type INIConflict struct {
+	File    string      `json:"file"`
+	Root    InstallRoot `json:"root"`
+	Section string      `json:"section"`
+	Key     string      `json:"key"`
+
+	// Settings is every value set for the key, in deploy order.
+	Settings []*INISetting `json:"settings"`
+
+	// Winner is the mod whose value is applied.
+	Winner Repo `json:"winner"`
+}
+
+// DeployedINI is an INI setting applied by a deployment, and the value it
+// replaced.
+type DeployedINI struct {
+	INISetting
+
+	// Previous is the value before the setting was applied, nil when the
+	// key did not exist.
+	Previous *string `json:"previous,omitempty"`
+
+	// Created is true when the INI file was created by the deployment.
+	Created bool `json:"created,omitempty"`
+}
+
+// installRoot returns the install root for the tweak, defaulting to the game
+// directory.
+func (t *INITweak) installRoot() InstallRoot {
+	if t.Root == "" {
+		return GameRoot
+	}
+	return t.Root
+}
+
+// key returns the case insensitive map key for the INI key set by the tweak.
+func (t *INITweak) key() string {
+	return strings.Join([]string{
+		string(t.installRoot()),
+		lowerPath(cleanPath(t.File)),
+		strings.ToLower(strings.TrimSpace(t.Section)),
+		strings.ToLower(strings.TrimSpace(t.Key)),
+	}, "\x00")
+}
+
+// validate checks the tweak has a file and key.
+func (t *INITweak) validate(repo Repo) error {
+	if cleanPath(t.File) == "" || strings.TrimSpace(t.Key) == "" {
+		return NewError(ErrCodeInvalidInput, repo, "", fmt.Errorf("INI tweaks must set a file and key"))
+	}
+	switch t.installRoot() {
+	case GameRoot, DocumentsRoot, AppDataRoot:
+	default:
+		return NewError(ErrCodeInvalidInput, repo, "", fmt.Errorf("unknown install root '%s' for INI file '%s'", t.Root, t.File))
+	}
+	return nil
+}
+
+// planINI resolves the INI settings for every mod in deploy order, followed by
+// the root manifest settings. The last value set for a key wins, and keys set
+// to different values by more than one mod are returned as conflicts.
+func (p *Plan) planINI(settings []*INISetting) error {
+	byKey := map[string][]*INISetting{}
+	var keys []string
+	for _, s := range settings {
+		if err := s.validate(s.Repo); err != nil {
+			return err
+		}
+		k := s.key()
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], s)
+	}
+
+	for _, k := range keys {
+		list := byKey[k]
+		winner := list[len(list)-1]
+		p.INI = append(p.INI, winner)
+
+		values := map[string]bool{}
+		for _, s := range list {
+			values[strings.TrimSpace(s.Value)] = true
+		}
+		if len(values) < 2 {
+			continue
+		}
+		p.INIConflicts = append(p.INIConflicts, &INIConflict{
+			File:     winner.File,
+			Root:     winner.installRoot(),
+			Section:  winner.Section,
+			Key:      winner.Key,
+			Settings: list,
+			Winner:   winner.Repo,
+		})
+	}
+
+	sort.SliceStable(p.INIConflicts, func(i, j int) bool {
+		return p.INIConflicts[i].key() < p.INIConflicts[j].key()
+	})
+	return nil
+}
+
+// key returns the case insensitive sort key for the conflict.
+func (c *INIConflict) key() string {
+	t := INITweak{File: c.File, Root: c.Root, Section: c.Section, Key: c.Key}
+	return t.key()
+}
+
+// applyINI sets the value for an INI setting, creating the file and any
+// missing directories, and returns the record of the applied setting.
+func (s *Staging) applyINI(g *GameConfig, set *INISetting, d *Deployment) (*DeployedINI, error) {
+	rootDir, err := g.RootDir(set.installRoot())
+	if err != nil {
+		return nil, err
+	}
+	target := newCaseResolver(rootDir).Resolve(cleanPath(set.File))
+
+	f, err := readINI(target)
+	if err != nil {
+		return nil, err
+	}
+
+	di := &DeployedINI{INISetting: *set, Created: f == nil}
+	if f == nil {
+		f = &iniFile{crlf: true}
+		created, err := mkdirAll(rootDir, filepath.Dir(target))
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range created {
+			d.Dirs = append(d.Dirs, &DeployedPath{Root: set.installRoot(), Path: dir})
+		}
+	}
+	if v, ok := f.get(set.Section, set.Key); ok {
+		di.Previous = &v
+	}
+
+	f.set(set.Section, set.Key, set.Value)
+	if err := f.write(target); err != nil {
+		return di, err
+	}
+
+	// the write replaces links to staged files, so INI files deployed by
+	// mods are recorded as changed copies
+	rel, err := filepath.Rel(rootDir, target)
+	if err != nil {
+		return di, err
+	}
+	if df := d.file(set.installRoot(), filepath.ToSlash(rel)); df != nil {
+		return di, df.tweak(target)
+	}
+	return di, nil
+}
+
+// reapplyINI sets every deployment INI setting for a deployed file again,
+// after the file is replaced with the staged file.
+func (d *Deployment) reapplyINI(df *DeployedFile, target string) error {
+	var f *iniFile
+	for _, set := range d.INI {
+		if pathKey(set.installRoot(), cleanPath(set.File)) != pathKey(df.Root, df.Path) {
+			continue
+		}
+		if f == nil {
+			var err error
+			if f, err = readINI(target); err != nil || f == nil {
+				return err
+			}
+		}
+		f.set(set.Section, set.Key, set.Value)
+	}
+	if f == nil {
+		return nil
+	}
+
+	if err := f.write(target); err != nil {
+		return err
+	}
+	return df.tweak(target)
+}
+
+// revertINI restores the previous values for applied INI settings in reverse
+// order. Keys changed after deployment are left in place, and INI files created
+// by the deployment are removed when no keys remain.
+func (s *Staging) revertINI(g *GameConfig, settings []*DeployedINI) error {
+	for i := len(settings) - 1; i >= 0; i-- {
+		set := settings[i]
+		rootDir, err := g.RootDir(set.installRoot())
+		if err != nil {
+			return err
+		}
+		target := newCaseResolver(rootDir).Resolve(cleanPath(set.File))
+
+		f, err := readINI(target)
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			continue
+		}
+		if v, ok := f.get(set.Section, set.Key); !ok || v != strings.TrimSpace(set.Value) {
+			continue
+		}
+
+		if set.Previous != nil {
+			f.set(set.Section, set.Key, *set.Previous)
+		} else {
+			f.remove(set.Section, set.Key)
+		}
+
+		if set.Created && f.empty() {
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if err := f.write(target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iniFile is the lines of an INI file, edited in place so comments and
+// formatting are kept.
+type iniFile struct {
+	lines []string
+	crlf  bool
+	bom   bool
+}
+
+// readINI reads an INI file. A missing file returns nil.
+func readINI(path string) (*iniFile, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	content := strings.TrimPrefix(string(b), "\ufeff")
+	f := &iniFile{
+		crlf: strings.Contains(content, "\r\n"),
+		bom:  len(content) < len(b),
+	}
+	content = strings.TrimRight(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if content != "" {
+		f.lines = strings.Split(content, "\n")
+	}
+	return f, nil
+}
+
+// write replaces the file on disk, so a partial write never replaces the
+// file.
+func (f *iniFile) write(path string) error {
+	eol := "\n"
+	if f.crlf {
+		eol = "\r\n"
+	}
+
+	var content string
+	if f.bom {
+		content = "\ufeff"
+	}
+	for _, l := range f.lines {
+		content += l + eol
+	}
+
+	tmp := path + ".swizzle"
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// iniSection returns the section name for a section header line.
+func iniSection(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+		return strings.TrimSpace(line[1 : len(line)-1]), true
+	}
+	return "", false
+}
+
+// iniKey returns the key and value for a key line.
+func iniKey(line string) (string, string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	parts := strings.SplitN(line, "=", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), true
+}
+
+// find returns the line index of a key in a section, and the index of the
+// line after the last line in the section, or -1 when the section is missing.
+func (f *iniFile) find(section, key string) (int, int) {
+	section = strings.TrimSpace(section)
+	current := ""
+	found, end := -1, -1
+	if section == "" {
+		end = 0
+	}
+	for i, l := range f.lines {
+		if name, ok := iniSection(l); ok {
+			current = name
+			if strings.EqualFold(name, section) && end < 0 {
+				end = i + 1
+			}
+			continue
+		}
+		if !strings.EqualFold(current, section) {
+			continue
+		}
+		if k, _, ok := iniKey(l); ok {
+			end = i + 1
+			if found < 0 && strings.EqualFold(k, strings.TrimSpace(key)) {
+				found = i
+			}
+		}
+	}
+	return found, end
+}
+
+// get returns the value of a key in a section.
+func (f *iniFile) get(section, key string) (string, bool) {
+	i, _ := f.find(section, key)
+	if i < 0 {
+		return "", false
+	}
+	_, v, _ := iniKey(f.lines[i])
+	return v, true
+}
+
+// set replaces the value of a key, keeping the key name as written in the
+// file. Missing keys are added at the end of the section, and missing sections
+// at the end of the file.
+func (f *iniFile) set(section, key, value string) {
+	i, end := f.find(section, key)
+	if i >= 0 {
+		k, _, _ := iniKey(f.lines[i])
+		f.lines[i] = k + "=" + strings.TrimSpace(value)
+		return
+	}
+
+	line := strings.TrimSpace(key) + "=" + strings.TrimSpace(value)
+	if end >= 0 {
+		f.lines = append(f.lines[:end], append([]string{line}, f.lines[end:]...)...)
+		return
+	}
+	if len(f.lines) > 0 && strings.TrimSpace(f.lines[len(f.lines)-1]) != "" {
+		f.lines = append(f.lines, "")
+	}
+	f.lines = append(f.lines, "["+strings.TrimSpace(section)+"]", line)
+}
+
+// remove deletes a key from a section. A section left without any lines is
+// removed with the blank line before it.
+func (f *iniFile) remove(section, key string) {
+	i, _ := f.find(section, key)
+	if i < 0 {
+		return
+	}
+	f.lines = append(f.lines[:i], f.lines[i+1:]...)
+
+	// find the section header and the end of the section
+	start := -1
+	for j := i - 1; j >= 0; j-- {
+		if _, ok := iniSection(f.lines[j]); ok {
+			start = j
+			break
+		}
+	}
+	if start < 0 {
+		return
+	}
+	end := start + 1
+	for end < len(f.lines) {
+		if _, ok := iniSection(f.lines[end]); ok {
+			break
+		}
+		if strings.TrimSpace(f.lines[end]) != "" {
+			return
+		}
+		end++
+	}
+
+	if start > 0 && strings.TrimSpace(f.lines[start-1]) == "" && end == len(f.lines) {
+		start--
+	}
+	f.lines = append(f.lines[:start], f.lines[end:]...)
+}
+
+// empty is true when the file has no keys.
+func (f *iniFile) empty() bool {
+	for _, l := range f.lines {
+		if _, _, ok := iniKey(l); ok {
+			return false
+		}
+	}
+	return true
+}
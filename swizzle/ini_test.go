@@ -0,0 +1,222 @@
+package swizzle
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestINIFileFind(t *testing.T) {
+	f := &iniFile{lines: []string{
+		"; comment",
+		"top=1",
+		"",
+		"[Display]",
+		"fShadow = 2",
+		"; iHidden=1",
+		"iSize=3",
+		"",
+		"[ General ]",
+		"sLanguage=EN",
+	}}
+
+	tests := []struct {
+		section string
+		key     string
+		found   int
+		end     int
+	}{
+		{"", "top", 1, 2},
+		{"Display", "fShadow", 4, 7},
+		{"display", "ISIZE", 6, 7},
+		{"Display", "missing", -1, 7},
+		{"Display", "iHidden", -1, 7},
+		{"General", "sLanguage", 9, 10},
+		{"Missing", "top", -1, -1},
+	}
+
+	for _, tt := range tests {
+		found, end := f.find(tt.section, tt.key)
+		if found != tt.found || end != tt.end {
+			t.Errorf("find(%q, %q) = %d, %d, want %d, %d", tt.section, tt.key, found, end, tt.found, tt.end)
+		}
+	}
+
+	if v, ok := f.get("display", "fshadow"); !ok || v != "2" {
+		t.Errorf("get = %q, %v, want \"2\", true", v, ok)
+	}
+}
+
+func TestINIFileSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		section string
+		key     string
+		value   string
+		want    []string
+	}{
+		{
+			name:    "replace keeps the key name",
+			lines:   []string{"[Display]", "fShadow = 2"},
+			section: "display",
+			key:     "FSHADOW",
+			value:   " 4 ",
+			want:    []string{"[Display]", "fShadow=4"},
+		},
+		{
+			name:    "add to the end of a section",
+			lines:   []string{"[Display]", "a=1", "", "[General]", "b=2"},
+			section: "Display",
+			key:     "c",
+			value:   "3",
+			want:    []string{"[Display]", "a=1", "c=3", "", "[General]", "b=2"},
+		},
+		{
+			name:    "add to an empty section",
+			lines:   []string{"[General]"},
+			section: "General",
+			key:     "b",
+			value:   "2",
+			want:    []string{"[General]", "b=2"},
+		},
+		{
+			name:    "add a section",
+			lines:   []string{"[Display]", "a=1"},
+			section: "General",
+			key:     "b",
+			value:   "2",
+			want:    []string{"[Display]", "a=1", "", "[General]", "b=2"},
+		},
+		{
+			name:    "add to an empty file",
+			section: "General",
+			key:     "b",
+			value:   "2",
+			want:    []string{"[General]", "b=2"},
+		},
+		{
+			name:  "add a key without a section",
+			lines: []string{"[A]", "x=1"},
+			key:   "top",
+			value: "1",
+			want:  []string{"top=1", "[A]", "x=1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &iniFile{lines: append([]string{}, tt.lines...)}
+			f.set(tt.section, tt.key, tt.value)
+			if !reflect.DeepEqual(f.lines, tt.want) {
+				t.Errorf("got %q, want %q", f.lines, tt.want)
+			}
+		})
+	}
+}
+
+func TestINIFileRemove(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		section string
+		key     string
+		want    []string
+	}{
+		{
+			name:    "remove a key",
+			lines:   []string{"[A]", "x=1", "y=2"},
+			section: "a",
+			key:     "X",
+			want:    []string{"[A]", "y=2"},
+		},
+		{
+			name:    "remove the last section with the blank line before it",
+			lines:   []string{"[A]", "x=1", "", "[B]", "y=2"},
+			section: "B",
+			key:     "y",
+			want:    []string{"[A]", "x=1"},
+		},
+		{
+			name:    "remove an empty section",
+			lines:   []string{"[A]", "x=1", "", "[B]", "y=2"},
+			section: "A",
+			key:     "x",
+			want:    []string{"[B]", "y=2"},
+		},
+		{
+			name:    "keep a section with comments",
+			lines:   []string{"[A]", "; note", "x=1"},
+			section: "A",
+			key:     "x",
+			want:    []string{"[A]", "; note"},
+		},
+		{
+			name:    "missing key",
+			lines:   []string{"[A]", "x=1"},
+			section: "A",
+			key:     "y",
+			want:    []string{"[A]", "x=1"},
+		},
+		{
+			name:  "key without a section",
+			lines: []string{"top=1", "[A]", "x=1"},
+			key:   "top",
+			want:  []string{"[A]", "x=1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &iniFile{lines: append([]string{}, tt.lines...)}
+			f.remove(tt.section, tt.key)
+			if !reflect.DeepEqual(f.lines, tt.want) {
+				t.Errorf("got %q, want %q", f.lines, tt.want)
+			}
+		})
+	}
+}
+
+func TestINIFileReadWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"lf", "[A]\nx=1\n", "[A]\nx=1\ny=2\n"},
+		{"crlf with bom", "\ufeff[A]\r\nx=1\r\n", "\ufeff[A]\r\nx=1\r\ny=2\r\n"},
+		{"missing trailing newline", "[A]\nx=1", "[A]\nx=1\ny=2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "test.ini")
+			if err := os.WriteFile(file, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := readINI(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.set("A", "y", "2")
+			if err := f.write(file); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("got %q, want %q", b, tt.want)
+			}
+		})
+	}
+
+	f, err := readINI(filepath.Join(t.TempDir(), "missing.ini"))
+	if f != nil || err != nil {
+		t.Errorf("missing file: got %v, %v, want nil, nil", f, err)
+	}
+}
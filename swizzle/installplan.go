@@ -0,0 +1,329 @@
+package swizzle
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/afloesch/semver"
+)
+
+// FileAction is the change an install makes to a game file.
+type FileAction string
+
+const (
+	// CreateFile is a new file added to the game.
+	CreateFile FileAction = "create"
+
+	// OverwriteFile is an existing file replaced in the game. Original game
+	// files are backed up, and previously deployed mod files are replaced.
+	OverwriteFile FileAction = "overwrite"
+
+	// DeleteFile is a previously deployed mod file removed from the game.
+	DeleteFile FileAction = "delete"
+)
+
+// PlannedAsset is a release file an install downloads.
+type PlannedAsset struct {
+	Repo    Repo          `json:"repo"`
+	Version semver.String `json:"version"`
+	Name    string        `json:"name"`
+	Size    int64         `json:"size"`
+
+	// Cached is true when the release file is already downloaded.
+	Cached bool `json:"cached"`
+	// Fomod is true when the release file has a FOMOD installer. The planned
+	// files are the files the installer selects with the recorded choices or
+	// default options.
+	Fomod bool `json:"fomod,omitempty"`
+}
+
+// PlannedFile is a change an install makes to a game file.
+type PlannedFile struct {
+	DeployedPath
+
+	Repo   Repo       `json:"repo,omitempty"`
+	Size   int64      `json:"size"`
+	Action FileAction `json:"action"`
+}
+
+// InstallPlan is every change an install makes, computed without extracting
+// any release files or changing the game.
+type InstallPlan struct {
+	// Mods is every resolved mod release in deploy order.
+	Mods []*LockedMod `json:"mods"`
+
+	// Assets is every release file for mods which are not yet staged.
+	Assets []*PlannedAsset `json:"assets"`
+
+	// Files is every game file created, overwritten or deleted.
+	Files []*PlannedFile `json:"files"`
+
+	// Conflicts is every path provided by more than one mod.
+	Conflicts []*Conflict `json:"conflicts"`
+
+	// INI is the winning value for every INI key set by a mod.
+	INI []*INISetting `json:"ini,omitempty"`
+
+	// INIConflicts is every INI key set to different values by more than
+	// one mod.
+	INIConflicts []*INIConflict `json:"iniConflicts,omitempty"`
+
+	// Unlisted is every release file which is not downloaded, so the files
+	// in the release file are missing from the plan.
+	Unlisted []*PlannedAsset `json:"unlisted,omitempty"`
+
+	// DownloadSize is the total size in bytes of release files which are not
+	// cached.
+	DownloadSize int64 `json:"downloadSize"`
+
+	// DiskSize is the total disk space in bytes used by downloads, newly
+	// staged files, and deployed files when deploying copies.
+	DiskSize int64 `json:"diskSize"`
+}
+
+// InstallPlan computes the changes installing the manifest dependency graph
+// makes to the game. Release files for mods which are not yet staged are
+// listed from the archives in the cache directory, and download sizes come
+// from the release asset or the manifest size. When fetch is not nil it is
+// called to download each release file missing from the cache before the
+// archive is listed. Release files with a FOMOD installer list the files the
+// installer selects, and INI tweaks are planned as in Plan. Only the mods in
+// the active profile are planned for deployment.
+func (s *Staging) InstallPlan(
+	g *GameConfig,
+	m *Manifest,
+	graph *Graph,
+	cache string,
+	method DeployMethod,
+	fetch func(*Manifest, *ReleaseFile) error,
+) (*InstallPlan, error) {
+	ip := &InstallPlan{}
+	lock := graph.Lock()
+
+	// FOMOD installers run without prompts, as when installing without
+	// interactive input
+	o := &stageOptions{}
+	if lo, err := s.LoadOrder(g); err == nil {
+		o.fileState = FomodFileStates(lo)
+	}
+
+	modFiles := map[Repo][]*StagedFile{}
+	modINI := map[Repo][]*INITweak{}
+	for _, n := range graph.InstallOrder() {
+		mod := n.Manifest()
+		if s.IsStaged(mod.Repo, mod.Version) {
+			files, err := s.Files(mod.Repo, mod.Version)
+			if err != nil {
+				return nil, err
+			}
+			r, err := s.Release(mod.Repo, mod.Version)
+			if err != nil {
+				return nil, err
+			}
+			modFiles[mod.Repo] = files
+			modINI[mod.Repo] = r.INI
+			continue
+		}
+		modINI[mod.Repo] = mod.INI
+
+		for _, f := range mod.Files {
+			if err := f.validateRoot(mod); err != nil {
+				return nil, err
+			}
+			size := f.size
+			if size == 0 {
+				size = f.Bytes
+			}
+			asset := &PlannedAsset{
+				Repo:    mod.Repo,
+				Version: mod.Version,
+				Name:    f.Name,
+				Size:    size,
+				Cached:  f.Cached(cache, mod),
+			}
+			ip.Assets = append(ip.Assets, asset)
+			if !asset.Cached {
+				ip.DownloadSize += asset.Size
+				if fetch != nil {
+					if err := fetch(mod, f); err != nil {
+						return nil, err
+					}
+				}
+			}
+
+			if f.archive == nil {
+				ip.Unlisted = append(ip.Unlisted, asset)
+				continue
+			}
+
+			entries, err := f.archive.List(f.Source)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range entries {
+				if lowerPath(e.Name) == strings.ToLower(FomodConfigPath) {
+					asset.Fomod = true
+				}
+			}
+			if asset.Fomod {
+				if entries, err = o.fomodFiles(mod, f, entries); err != nil {
+					return nil, fmt.Errorf("'%s' %s: %w", f.Name, mod.Repo, err)
+				}
+			}
+			for _, e := range entries {
+				ip.DiskSize += e.Size
+				modFiles[mod.Repo] = append(modFiles[mod.Repo], &StagedFile{
+					Root:    f.InstallRoot(),
+					Path:    path.Join(cleanPath(f.Destination), e.Name),
+					Size:    e.Size,
+					Repo:    mod.Repo,
+					Version: mod.Version,
+				})
+			}
+		}
+	}
+
+	// only the mods in the active profile are deployed
+	mods := lock.Mods
+	profile, err := s.ActiveProfile()
+	if err != nil {
+		return nil, err
+	}
+	if profile != nil {
+		if m, mods, err = profile.Apply(s, m, mods, graph); err != nil {
+			return nil, err
+		}
+	}
+
+	p, err := m.plan(mods, modFiles)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.planModINI(m, modINI); err != nil {
+		return nil, err
+	}
+	ip.Mods = p.Mods
+	ip.Conflicts = p.Conflicts
+	ip.INI = p.INI
+	ip.INIConflicts = p.INIConflicts
+	ip.DiskSize += ip.DownloadSize
+
+	d, err := s.Deployment()
+	if err != nil {
+		return nil, err
+	}
+	deployed := map[DeployedPath]bool{}
+	for _, f := range d.Files {
+		deployed[pathKey(f.Root, f.Path)] = true
+	}
+
+	planned := map[DeployedPath]bool{}
+	resolvers := map[InstallRoot]*caseResolver{}
+	for _, f := range p.Files {
+		k := pathKey(f.Root, f.Path)
+		planned[k] = true
+
+		rootDir, err := g.RootDir(f.Root)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := resolvers[f.Root]
+		if !ok {
+			r = newCaseResolver(rootDir)
+			resolvers[f.Root] = r
+		}
+
+		target := r.Resolve(f.Path)
+		rel, err := filepath.Rel(rootDir, target)
+		if err != nil {
+			return nil, err
+		}
+
+		action := CreateFile
+		if _, err := os.Lstat(target); err == nil || deployed[k] {
+			action = OverwriteFile
+		}
+
+		if method == CopyDeploy {
+			ip.DiskSize += f.Size
+		}
+		ip.Files = append(ip.Files, &PlannedFile{
+			DeployedPath: DeployedPath{Root: f.Root, Path: filepath.ToSlash(rel)},
+			Repo:         f.Repo,
+			Size:         f.Size,
+			Action:       action,
+		})
+	}
+
+	for _, f := range d.Files {
+		if planned[pathKey(f.Root, f.Path)] {
+			continue
+		}
+		ip.Files = append(ip.Files, &PlannedFile{
+			DeployedPath: f.DeployedPath,
+			Repo:         f.Repo,
+			Action:       DeleteFile,
+		})
+	}
+
+	sort.SliceStable(ip.Files, func(i, j int) bool {
+		if ip.Files[i].Root != ip.Files[j].Root {
+			return ip.Files[i].Root < ip.Files[j].Root
+		}
+		return lowerPath(ip.Files[i].Path) < lowerPath(ip.Files[j].Path)
+	})
+
+	return ip, nil
+}
+
+// fomodFiles runs the FOMOD installer in a release file and returns the
+// selected archive files, named by their path in the release file
+// destination. Files installed later replace earlier files with the same path.
+func (o *stageOptions) fomodFiles(m *Manifest, f *ReleaseFile, entries []ArchiveFile) ([]ArchiveFile, error) {
+	c, err := ReadArchiveFomod(f.archive, f.Source)
+	if err != nil {
+		return nil, err
+	}
+	inst, err := c.Install(o.fomodSelector(m, f), o.fileState)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []ArchiveFile
+	index := map[string]int{}
+	add := func(name string, size int64) {
+		name = cleanPath(name)
+		key := lowerPath(name)
+		if i, ok := index[key]; ok {
+			files[i] = ArchiveFile{Name: name, Size: size}
+			return
+		}
+		index[key] = len(files)
+		files = append(files, ArchiveFile{Name: name, Size: size})
+	}
+
+	for _, file := range inst.Files {
+		src := lowerPath(file.Source)
+		found := false
+		for _, e := range entries {
+			name := lowerPath(e.Name)
+			switch {
+			case name == src:
+				add(file.Destination, e.Size)
+			case file.Folder && (src == "" || strings.HasPrefix(name, src+"/")):
+				add(path.Join(file.Destination, e.Name[len(file.Source):]), e.Size)
+			default:
+				continue
+			}
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("FOMOD file '%s' is missing from the archive", file.Source)
+		}
+	}
+	return files, nil
+}
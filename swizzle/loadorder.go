@@ -0,0 +1,427 @@
+package swizzle
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PluginsFileName is the file listing enabled plugins, read by the game.
+const PluginsFileName string = "plugins.txt"
+
+// LoadOrderFileName is the file listing every plugin in load order, read by
+// mod tools.
+const LoadOrderFileName string = "loadorder.txt"
+
+// PluginRule declares a plugin provided by a release file, and where it
+// belongs in the load order relative to other plugins.
+type PluginRule struct {
+	// Name is the plugin file name.
+	Name string `json:"name" yaml:"name"`
+
+	// LoadAfter is the plugins which must load before this plugin when they
+	// are installed.
+	LoadAfter []string `json:"loadAfter,omitempty" yaml:"loadAfter,omitempty"`
+
+	// LoadBefore is the plugins which must load after this plugin when they
+	// are installed.
+	LoadBefore []string `json:"loadBefore,omitempty" yaml:"loadBefore,omitempty"`
+
+	// Disabled installs the plugin without enabling it.
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+}
+
+// LoadOrderPlugin is a plugin in the load order.
+type LoadOrderPlugin struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Master  bool   `json:"master"`
+	Light   bool   `json:"light"`
+
+	// Repo is the mod which deployed the plugin, empty for base game plugins.
+	Repo Repo `json:"repo,omitempty"`
+
+	masters []string
+	after   []string
+	before  []string
+	rank    int
+}
+
+// LoadOrder is every plugin in the game Data directory in load order.
+type LoadOrder struct {
+	Plugins []*LoadOrderPlugin `json:"plugins"`
+
+	// Skipped is every plugin which could not be read, and is left out of
+	// the load order.
+	Skipped []*UnreadablePlugin `json:"skipped,omitempty"`
+}
+
+// LoadOrder sorts every plugin in the game Data directory. Masters always
+// load before the plugins which depend on them, and plugins flagged as
+// masters load before all other plugins. Base game plugins keep the order
+// from the existing load order files, followed by mod plugins in deploy
+// order, adjusted for the loadAfter and loadBefore rules declared in the mod
+// manifests. Plugins which cannot be read are skipped.
+func (s *Staging) LoadOrder(g *GameConfig) (*LoadOrder, error) {
+	d, err := s.Deployment()
+	if err != nil {
+		return nil, err
+	}
+	return s.loadOrder(g, d)
+}
+
+// loadOrder sorts every plugin in the game Data directory for a deployment.
+func (s *Staging) loadOrder(g *GameConfig, d *Deployment) (*LoadOrder, error) {
+	// enabled state and order from the existing load order files
+	previous, err := readLoadOrderFiles(g)
+	if err != nil {
+		return nil, err
+	}
+	prevRank := map[string]*LoadOrderPlugin{}
+	for i, p := range previous {
+		p.rank = i
+		prevRank[strings.ToLower(p.Name)] = p
+	}
+
+	rules := map[string]*PluginRule{}
+	deployed := map[string]*DeployedFile{}
+	modRank := map[Repo]int{}
+	for i, m := range d.Mods {
+		modRank[m.Repo] = i
+		r, err := s.Release(m.Repo, m.Version)
+		if err != nil {
+			continue
+		}
+		for _, a := range r.Files {
+			for _, rule := range a.Plugins {
+				rules[strings.ToLower(rule.Name)] = rule
+			}
+		}
+	}
+	for _, f := range d.Files {
+		if f.Root == GameRoot && lowerPath(path.Dir(f.Path)) == "data" && IsPlugin(f.Path) {
+			deployed[strings.ToLower(path.Base(f.Path))] = f
+		}
+	}
+
+	dataDir := newCaseResolver(g.GameDir()).Resolve("Data")
+	entries, err := os.ReadDir(dataDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	lo := &LoadOrder{}
+	var base, mods []*LoadOrderPlugin
+	for _, e := range entries {
+		if e.IsDir() || !IsPlugin(e.Name()) {
+			continue
+		}
+		key := strings.ToLower(e.Name())
+
+		plugin, err := ReadPlugin(filepath.Join(dataDir, e.Name()))
+		if err != nil {
+			skipped := &UnreadablePlugin{Plugin: e.Name(), Error: err.Error()}
+			if f, ok := deployed[key]; ok {
+				skipped.Repo = f.Repo
+			}
+			lo.Skipped = append(lo.Skipped, skipped)
+			continue
+		}
+		p := &LoadOrderPlugin{
+			Name:    e.Name(),
+			Enabled: true,
+			Master:  plugin.Master() || strings.EqualFold(path.Ext(e.Name()), ".esl"),
+			Light:   plugin.Light(),
+			masters: plugin.Masters,
+		}
+
+		if f, ok := deployed[key]; ok {
+			p.Repo = f.Repo
+			if rule, ok := rules[key]; ok {
+				p.Enabled = !rule.Disabled
+				p.after = rule.LoadAfter
+				p.before = rule.LoadBefore
+			}
+			mods = append(mods, p)
+			continue
+		}
+
+		if prev, ok := prevRank[key]; ok {
+			p.Enabled = prev.Enabled
+			p.rank = prev.rank
+		} else {
+			p.rank = len(previous) + len(base)
+		}
+		base = append(base, p)
+	}
+
+	sort.SliceStable(base, func(i, j int) bool {
+		return base[i].rank < base[j].rank
+	})
+	sort.SliceStable(mods, func(i, j int) bool {
+		if mods[i].Repo != mods[j].Repo {
+			return modRank[mods[i].Repo] < modRank[mods[j].Repo]
+		}
+		return strings.ToLower(mods[i].Name) < strings.ToLower(mods[j].Name)
+	})
+
+	plugins := append(base, mods...)
+	for i, p := range plugins {
+		p.rank = i
+	}
+
+	var masters, others []*LoadOrderPlugin
+	for _, p := range plugins {
+		if p.Master {
+			masters = append(masters, p)
+		} else {
+			others = append(others, p)
+		}
+	}
+
+	for _, group := range [][]*LoadOrderPlugin{masters, others} {
+		sorted, err := sortPlugins(group)
+		if err != nil {
+			return nil, err
+		}
+		lo.Plugins = append(lo.Plugins, sorted...)
+	}
+	return lo, nil
+}
+
+// sortPlugins topologically sorts plugins so every plugin loads after its
+// masters and loadAfter rules, and before its loadBefore rules. Rules for
+// plugins which are not in the group are ignored. Plugins keep their rank
+// order wherever the rules allow.
+func sortPlugins(plugins []*LoadOrderPlugin) ([]*LoadOrderPlugin, error) {
+	byName := map[string]*LoadOrderPlugin{}
+	for _, p := range plugins {
+		byName[strings.ToLower(p.Name)] = p
+	}
+
+	after := map[*LoadOrderPlugin]map[*LoadOrderPlugin]bool{}
+	edge := func(first, then *LoadOrderPlugin) {
+		if first == nil || then == nil || first == then {
+			return
+		}
+		if after[then] == nil {
+			after[then] = map[*LoadOrderPlugin]bool{}
+		}
+		after[then][first] = true
+	}
+	for _, p := range plugins {
+		for _, m := range p.masters {
+			edge(byName[strings.ToLower(m)], p)
+		}
+		for _, a := range p.after {
+			edge(byName[strings.ToLower(a)], p)
+		}
+		for _, b := range p.before {
+			edge(p, byName[strings.ToLower(b)])
+		}
+	}
+
+	var sorted []*LoadOrderPlugin
+	placed := map[*LoadOrderPlugin]bool{}
+	for len(sorted) < len(plugins) {
+		var next *LoadOrderPlugin
+		for _, p := range plugins {
+			if placed[p] || (next != nil && p.rank >= next.rank) {
+				continue
+			}
+			ready := true
+			for first := range after[p] {
+				if !placed[first] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = p
+			}
+		}
+
+		if next == nil {
+			var cycle []string
+			for _, p := range plugins {
+				if !placed[p] {
+					cycle = append(cycle, p.Name)
+				}
+			}
+			return nil, NewError(ErrCodeIncompatible, "", "", fmt.Errorf("plugin load order rules form a cycle: %s", strings.Join(cycle, ", ")))
+		}
+
+		placed[next] = true
+		sorted = append(sorted, next)
+	}
+	return sorted, nil
+}
+
+// readLoadOrderFiles reads the plugins in the game load order files, in
+// loadorder.txt order with the enabled state from plugins.txt. Games without
+// an app data directory have no load order files.
+func readLoadOrderFiles(g *GameConfig) ([]*LoadOrderPlugin, error) {
+	dir, err := g.RootDir(AppDataRoot)
+	if err != nil {
+		return nil, nil
+	}
+	return readLoadOrderDir(dir)
+}
+
+// readLoadOrderDir reads the plugins in the loadorder.txt and plugins.txt files
+// in a directory, in loadorder.txt order with the enabled state from
+// plugins.txt.
+func readLoadOrderDir(dir string) ([]*LoadOrderPlugin, error) {
+	plugins, err := readPluginsFile(filepath.Join(dir, LoadOrderFileName))
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := readPluginsFile(filepath.Join(dir, PluginsFileName))
+	if err != nil {
+		return nil, err
+	}
+	if len(plugins) == 0 {
+		return enabled, nil
+	}
+	if len(enabled) > 0 {
+		state := map[string]bool{}
+		for _, p := range enabled {
+			state[strings.ToLower(p.Name)] = p.Enabled
+		}
+		for _, p := range plugins {
+			p.Enabled = state[strings.ToLower(p.Name)]
+		}
+	}
+	return plugins, nil
+}
+
+// readPluginsFile parses a plugins.txt or loadorder.txt file. Lines starting
+// with * are enabled plugins. Files without any * markers list only enabled
+// plugins. A missing file is an empty list.
+func readPluginsFile(file string) ([]*LoadOrderPlugin, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var plugins []*LoadOrderPlugin
+	markers := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p := &LoadOrderPlugin{Name: line}
+		if strings.HasPrefix(line, "*") {
+			markers = true
+			p.Name = strings.TrimSpace(line[1:])
+			p.Enabled = true
+		}
+		plugins = append(plugins, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !markers {
+		for _, p := range plugins {
+			p.Enabled = true
+		}
+	}
+	return plugins, nil
+}
+
+// WriteFiles writes plugins.txt, with every plugin and a * marker for enabled
+// plugins, and loadorder.txt with every plugin, to a directory.
+func (lo *LoadOrder) WriteFiles(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	plugins := "# This file is used by the game to keep track of your downloaded content.\r\n"
+	order := "# This file was automatically generated by swizzle.\r\n"
+	for _, p := range lo.Plugins {
+		if p.Enabled {
+			plugins += "*"
+		}
+		plugins += p.Name + "\r\n"
+		order += p.Name + "\r\n"
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, PluginsFileName), []byte(plugins), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, LoadOrderFileName), []byte(order), 0644)
+}
+
+// WriteLoadOrder sorts every plugin in the game Data directory and writes the
+// load order files to the game app data directory. Nothing is written when the
+// game has no plugins and no existing plugins.txt.
+func (s *Staging) WriteLoadOrder(g *GameConfig) (*LoadOrder, error) {
+	d, err := s.Deployment()
+	if err != nil {
+		return nil, err
+	}
+	return s.writeLoadOrder(g, d)
+}
+
+// writeLoadOrder sorts every plugin in the game Data directory for a
+// deployment and writes the load order files.
+func (s *Staging) writeLoadOrder(g *GameConfig, d *Deployment) (*LoadOrder, error) {
+	lo, err := s.loadOrder(g, d)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, derr := g.RootDir(AppDataRoot)
+	if len(lo.Plugins) == 0 {
+		if derr != nil {
+			return lo, nil
+		}
+		if _, err := os.Stat(filepath.Join(dir, PluginsFileName)); err != nil {
+			return lo, nil
+		}
+	}
+	if derr != nil {
+		return nil, derr
+	}
+	return lo, lo.WriteFiles(dir)
+}
+
+// WriteLoadOrder sorts every plugin in the game Data directory for the
+// deployment created by the transaction, and writes the load order files. The
+// previous load order files are restored on rollback.
+func (t *Transaction) WriteLoadOrder() (*LoadOrder, error) {
+	if err := t.saveLoadOrder(); err != nil {
+		return nil, err
+	}
+	return t.staging.writeLoadOrder(t.game, t.deployment())
+}
+
+// saveLoadOrder saves the load order files, so they are restored on rollback.
+// Games without an app data directory have no load order files.
+func (t *Transaction) saveLoadOrder() error {
+	if t.game == nil {
+		return fmt.Errorf("transaction has no game to deploy to")
+	}
+	dir, err := t.game.RootDir(AppDataRoot)
+	if err != nil {
+		return nil
+	}
+	for _, name := range []string{PluginsFileName, LoadOrderFileName} {
+		if err := t.save(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
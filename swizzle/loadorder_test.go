@@ -0,0 +1,110 @@
+package swizzle
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSortPlugins(t *testing.T) {
+	tests := []struct {
+		name    string
+		plugins []*LoadOrderPlugin
+		want    []string
+		err     string
+	}{
+		{
+			name: "rank order without rules",
+			plugins: []*LoadOrderPlugin{
+				{Name: "B.esp", rank: 1},
+				{Name: "A.esp", rank: 0},
+				{Name: "C.esp", rank: 2},
+			},
+			want: []string{"A.esp", "B.esp", "C.esp"},
+		},
+		{
+			name: "masters load first",
+			plugins: []*LoadOrderPlugin{
+				{Name: "Patch.esp", rank: 0, masters: []string{"Base.esp"}},
+				{Name: "Base.esp", rank: 1},
+			},
+			want: []string{"Base.esp", "Patch.esp"},
+		},
+		{
+			name: "masters match case insensitively",
+			plugins: []*LoadOrderPlugin{
+				{Name: "Patch.esp", rank: 0, masters: []string{"BASE.ESP"}},
+				{Name: "Base.esp", rank: 1},
+			},
+			want: []string{"Base.esp", "Patch.esp"},
+		},
+		{
+			name: "load after and before rules",
+			plugins: []*LoadOrderPlugin{
+				{Name: "A.esp", rank: 0, after: []string{"C.esp"}},
+				{Name: "B.esp", rank: 1},
+				{Name: "C.esp", rank: 2, before: []string{"B.esp"}},
+			},
+			want: []string{"C.esp", "A.esp", "B.esp"},
+		},
+		{
+			name: "rules for missing plugins are ignored",
+			plugins: []*LoadOrderPlugin{
+				{Name: "A.esp", rank: 0, masters: []string{"Missing.esm"}, after: []string{"Other.esp"}},
+				{Name: "B.esp", rank: 1, before: []string{"Gone.esp"}},
+			},
+			want: []string{"A.esp", "B.esp"},
+		},
+		{
+			name: "self rules are ignored",
+			plugins: []*LoadOrderPlugin{
+				{Name: "A.esp", rank: 0, after: []string{"a.esp"}},
+			},
+			want: []string{"A.esp"},
+		},
+		{
+			name: "master cycle",
+			plugins: []*LoadOrderPlugin{
+				{Name: "A.esp", rank: 0, masters: []string{"B.esp"}},
+				{Name: "B.esp", rank: 1, masters: []string{"A.esp"}},
+				{Name: "C.esp", rank: 2},
+			},
+			err: "cycle: A.esp, B.esp",
+		},
+		{
+			name: "rule cycle",
+			plugins: []*LoadOrderPlugin{
+				{Name: "A.esp", rank: 0, after: []string{"B.esp"}},
+				{Name: "B.esp", rank: 1, after: []string{"C.esp"}},
+				{Name: "C.esp", rank: 2, before: []string{"A.esp"}, after: []string{"A.esp"}},
+			},
+			err: "cycle: A.esp, B.esp, C.esp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted, err := sortPlugins(tt.plugins)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				if ErrorCodeOf(err) != ErrCodeIncompatible {
+					t.Errorf("expected error code %v, got %v", ErrCodeIncompatible, ErrorCodeOf(err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, p := range sorted {
+				names = append(names, p.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
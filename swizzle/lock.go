@@ -0,0 +1,98 @@
+package swizzle
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/afloesch/semver"
+	"gopkg.in/yaml.v3"
+)
+
+const lockName string = "swizzle.lock"
+
+// LockedMod is a resolved mod release version.
+type LockedMod struct {
+	Repo    Repo          `json:"repo" yaml:"repo"`
+	Version semver.String `json:"version" yaml:"version"`
+}
+
+// Lock is the set of resolved mod release versions for a manifest, in install
+// order. Dependencies are always installed before the mods which depend on them.
+type Lock struct {
+	Mods []*LockedMod `json:"mods" yaml:"mods"`
+}
+
+// LockPath returns the lock file location for a manifest file, which is
+// swizzle.lock in the same directory as the manifest.
+func LockPath(manifest string) string {
+	return filepath.Join(filepath.Dir(filepath.Clean(manifest)), lockName)
+}
+
+// ReadLock parses a lock file from the file system at the given path.
+func ReadLock(path string) (*Lock, error) {
+	b, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var l Lock
+	if err := yaml.Unmarshal(b, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// WriteFile adds the lock file to the file system at the given path.
+func (l *Lock) WriteFile(path string) error {
+	content, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Clean(path), content, 0644)
+}
+
+// Lock returns the lock for the graph with all dependencies in install order.
+func (g *Graph) Lock() *Lock {
+	l := &Lock{}
+	for _, n := range g.InstallOrder() {
+		l.Mods = append(l.Mods, &LockedMod{
+			Repo:    n.Repo,
+			Version: n.Version,
+		})
+	}
+	return l
+}
+
+// InstallOrder returns all dependency nodes in the graph ordered so every mod
+// comes after the mods it depends on. The root node is not included.
+func (g *Graph) InstallOrder() []*GraphNode {
+	nodes := map[string]*GraphNode{}
+	for _, n := range g.Nodes {
+		nodes[n.ID] = n
+	}
+
+	deps := map[string][]string{}
+	for _, e := range g.Edges {
+		deps[e.From] = append(deps[e.From], e.To)
+	}
+
+	var order []*GraphNode
+	visited := map[string]bool{}
+	var visit func(id string)
+	visit = func(id string) {
+		if visited[id] {
+			return
+		}
+		visited[id] = true
+		for _, d := range deps[id] {
+			visit(d)
+		}
+		if id != g.Root.ID {
+			order = append(order, nodes[id])
+		}
+	}
+	visit(g.Root.ID)
+
+	return order
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/afloesch/semver"
 	"github.com/google/go-github/v45/github"
@@ -29,6 +30,54 @@ type Game struct {
 	Version semver.String `json:"version,omitempty" yaml:"version,omitempty"`
 }
 
+// Compatible checks whether two games are the same game, and that the supported
+// game version ranges overlap. Empty values are compatible with everything.
+func (g Game) Compatible(other Game) bool {
+	if g.Executable != "" && other.Executable != "" &&
+		!strings.EqualFold(g.Executable, other.Executable) {
+		return false
+	}
+
+	return versionsOverlap(g.Version, other.Version)
+}
+
+// versionsOverlap checks whether any version satisfies both version strings.
+func versionsOverlap(a, b semver.String) bool {
+	if a == "" || b == "" {
+		return true
+	}
+
+	va := a.Get()
+	vb := b.Get()
+	if va.Operator() == "" {
+		return vb.OpCompare(va)
+	}
+	if vb.Operator() == "" {
+		return va.OpCompare(vb)
+	}
+
+	lower := func(v *semver.Version) bool {
+		return strings.HasPrefix(v.Operator(), ">")
+	}
+	if lower(va) == lower(vb) {
+		return true
+	}
+
+	lo, hi := va, vb
+	if !lower(va) {
+		lo, hi = vb, va
+	}
+
+	switch i := lo.Compare(hi); {
+	case i < 0:
+		return true
+	case i == 0:
+		return strings.HasSuffix(lo.Operator(), "=") && strings.HasSuffix(hi.Operator(), "=")
+	default:
+		return false
+	}
+}
+
 // Manifest defines the swiz.zle file format for a mod release. All mods released
 // for swizzle host mod releases publicly on GitHub, and include the release swiz.zle
 // file in the GitHub release assets.
@@ -53,6 +102,11 @@ type Manifest struct {
 	// See the Game struct for more information.
 	Game Game `json:"game,omitempty" yaml:"game,omitempty"`
 
+	// INI is the optional list of INI file values set when the mod is
+	// deployed. Previous values are restored when the mod is removed. Values
+	// set by the root manifest win over values set by dependencies.
+	INI []*INITweak `json:"ini,omitempty" yaml:"ini,omitempty"`
+
 	// License is an optional content license for the mod.
 	License string `json:"license,omitempty" yaml:"license,omitempty"`
 
@@ -60,6 +114,17 @@ type Manifest struct {
 	// field is not set.
 	Name string `json:"name,omitempty" yaml:"name,omitempty"`
 
+	// Overrides optionally sets the mod which wins a file conflict for a single
+	// file path, regardless of the mod priority. Paths are relative to the game
+	// directory, or to another install root when prefixed with the root name,
+	// for example "appdata:plugins.txt".
+	Overrides map[string]Repo `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+
+	// Priority is the optional mod order for resolving file conflicts between
+	// dependencies. Mods later in the list win conflicts with mods earlier in
+	// the list, and all listed mods win conflicts with unlisted mods.
+	Priority []Repo `json:"priority,omitempty" yaml:"priority,omitempty"`
+
 	// The GitHub repository for the mod release. See the swizzle Repo docs
 	// for more information.
 	Repo Repo `json:"repo,omitempty" yaml:"repo,omitempty"`
@@ -96,6 +161,12 @@ func (m *Manifest) SetVersion(version string) *Manifest {
 	return m
 }
 
+// ReleaseNotes returns the GitHub release notes for a manifest fetched from
+// a repo release.
+func (m *Manifest) ReleaseNotes() string {
+	return m.release.GetBody()
+}
+
 // AddDependency gets the specified release manifest and adds it and all dependencies
 // to the manifest.
 func (m *Manifest) AddDependency(ctx context.Context, repo string, version string) error {
@@ -135,12 +206,12 @@ func (m *Manifest) addDependency(repo Repo, version *semver.Version) error {
 			if ok := currVer.OpCompare(version); ok {
 				m.Dependency[repo] = version.ToString()
 			} else {
-				return fmt.Errorf(
+				return NewError(ErrCodeIncompatible, repo, version.String(), fmt.Errorf(
 					"'%s' version '%s' is incompatible with '%s'",
 					repo.String(),
 					currVer.String(),
 					version.String(),
-				)
+				))
 			}
 		}
 	}
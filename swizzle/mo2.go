@@ -0,0 +1,275 @@
+package swizzle
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/afloesch/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// MO2ModListName is the Mod Organizer 2 profile file listing every mod in
+// priority order.
+const MO2ModListName string = "modlist.txt"
+
+// mo2Separator is the name suffix of Mod Organizer 2 separators, which are
+// listed as mods but have no content.
+const mo2Separator string = "_separator"
+
+// mo2AnyVersion is the dependency version for imported mods without a mapped
+// version.
+const mo2AnyVersion semver.String = ">=v0.0.0"
+
+// MO2Mod is a mod in a Mod Organizer 2 profile.
+type MO2Mod struct {
+	// Name is the mod folder name in the Mod Organizer 2 mods directory.
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+
+	// NexusID is the Nexus Mods mod id from meta.ini, 0 when unknown.
+	NexusID int `json:"nexusId,omitempty"`
+
+	// Version, URL and InstallationFile are read from meta.ini.
+	Version          string `json:"version,omitempty"`
+	URL              string `json:"url,omitempty"`
+	InstallationFile string `json:"installationFile,omitempty"`
+}
+
+// MO2Profile is a Mod Organizer 2 profile.
+type MO2Profile struct {
+	Name string `json:"name"`
+
+	// Mods is every managed mod, lowest priority first. Separators and
+	// unmanaged entries such as base game DLC are not included.
+	Mods []*MO2Mod `json:"mods"`
+
+	// Plugins is the profile plugin load order.
+	Plugins []*LoadOrderPlugin `json:"plugins"`
+}
+
+// MO2Mapping maps Mod Organizer 2 mod names, or Nexus Mods ids in the form
+// nexus:<id>, to a GitHub repo with an optional version after an @, for
+// example "owner/name@>=v1.2.0". Names are matched case insensitively.
+type MO2Mapping map[string]string
+
+// MO2MappedMod is a Mod Organizer 2 mod mapped to a swizzle dependency.
+type MO2MappedMod struct {
+	Name    string        `json:"name"`
+	Repo    Repo          `json:"repo"`
+	Version semver.String `json:"version"`
+}
+
+// MO2Import is the result of mapping a Mod Organizer 2 profile to a
+// manifest.
+type MO2Import struct {
+	Manifest *Manifest `json:"manifest"`
+
+	// Mapped is every enabled mod added to the manifest, lowest priority
+	// first.
+	Mapped []*MO2MappedMod `json:"mapped"`
+
+	// Unmapped is every enabled mod without a mapping.
+	Unmapped []*MO2Mod `json:"unmapped"`
+}
+
+// ReadMO2Profile reads the mod list and plugins of a Mod Organizer 2 profile
+// directory, and the meta.ini of each mod in the mods directory. Mods without
+// a meta.ini are read from the mod list only.
+func ReadMO2Profile(profileDir, modsDir string) (*MO2Profile, error) {
+	list := filepath.Join(profileDir, MO2ModListName)
+	mods, err := readMO2ModList(list)
+	if os.IsNotExist(err) {
+		return nil, NewError(ErrCodeNotFound, "", "", fmt.Errorf("no %s in '%s'", MO2ModListName, profileDir))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range mods {
+		if err := m.readMeta(filepath.Join(modsDir, m.Name, "meta.ini")); err != nil {
+			return nil, fmt.Errorf("'%s': %w", m.Name, err)
+		}
+	}
+
+	plugins, err := readLoadOrderDir(profileDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MO2Profile{
+		Name:    filepath.Base(filepath.Clean(profileDir)),
+		Mods:    mods,
+		Plugins: plugins,
+	}, nil
+}
+
+// readMO2ModList parses a modlist.txt file. Lines start with + for enabled
+// mods, - for disabled mods, and * for unmanaged entries. The file lists the
+// highest priority mod first, and mods are returned lowest priority first.
+func readMO2ModList(file string) ([]*MO2Mod, error) {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mods []*MO2Mod
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if len(line) < 2 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name := strings.TrimSpace(line[1:])
+		if line[0] != '+' && line[0] != '-' || strings.HasSuffix(name, mo2Separator) {
+			continue
+		}
+		mods = append(mods, &MO2Mod{Name: name, Enabled: line[0] == '+'})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(mods)-1; i < j; i, j = i+1, j-1 {
+		mods[i], mods[j] = mods[j], mods[i]
+	}
+	return mods, nil
+}
+
+// readMeta sets the Nexus Mods id, version, URL and installation file from
+// the General section of a mod meta.ini file. A missing file is ignored.
+func (m *MO2Mod) readMeta(file string) error {
+	f, err := readINI(file)
+	if err != nil || f == nil {
+		return err
+	}
+
+	if v, ok := f.get("General", "modid"); ok {
+		if id, err := strconv.Atoi(v); err == nil && id > 0 {
+			m.NexusID = id
+		}
+	}
+	m.Version, _ = f.get("General", "version")
+	m.URL, _ = f.get("General", "url")
+	m.InstallationFile, _ = f.get("General", "installationFile")
+	return nil
+}
+
+// ReadMO2Mapping parses a YAML mapping file of Mod Organizer 2 mods to GitHub
+// repos.
+func ReadMO2Mapping(file string) (MO2Mapping, error) {
+	b, err := ioutil.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := MO2Mapping{}
+	if err := yaml.Unmarshal(b, &mapping); err != nil {
+		return nil, NewError(ErrCodeInvalidInput, "", "", fmt.Errorf("invalid mapping file '%s': %s", file, err))
+	}
+	return mapping.normalize()
+}
+
+// normalize returns the mapping with lower case keys trimmed of spaces, so
+// names are matched case insensitively. Keys which only differ by case are an
+// error.
+func (mapping MO2Mapping) normalize() (MO2Mapping, error) {
+	norm := MO2Mapping{}
+	names := map[string]string{}
+	for name, value := range mapping {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if prev, ok := names[key]; ok {
+			if prev > name {
+				prev, name = name, prev
+			}
+			return nil, NewError(ErrCodeInvalidInput, "", "", fmt.Errorf("mapping names '%s' and '%s' only differ by case", prev, name))
+		}
+		names[key] = name
+		norm[key] = value
+	}
+	return norm, nil
+}
+
+// lookup returns the repo and version mapped for a mod, matching the mod name
+// first and then the Nexus Mods id. The mapping keys must be normalized.
+func (mapping MO2Mapping) lookup(m *MO2Mod) (Repo, semver.String, bool, error) {
+	keys := []string{m.Name}
+	if m.NexusID > 0 {
+		keys = append(keys, fmt.Sprintf("nexus:%d", m.NexusID))
+	}
+
+	for _, k := range keys {
+		value, ok := mapping[strings.ToLower(strings.TrimSpace(k))]
+		if !ok {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimSpace(value), "@", 2)
+		repo, version := Repo(parts[0]), mo2AnyVersion
+		if len(parts) == 2 {
+			version = semver.String(parts[1])
+		}
+		if err := repo.Validate(); err != nil {
+			return "", "", false, err
+		}
+		if err := ValidateVersion(version); err != nil {
+			return "", "", false, NewError(ErrCodeInvalidInput, repo, string(version), fmt.Errorf("invalid version for '%s' in mapping: %s", k, err))
+		}
+		return repo, version, true, nil
+	}
+	return "", "", false, nil
+}
+
+// Import maps the enabled profile mods to manifest dependencies. The manifest
+// priority follows the Mod Organizer 2 mod priority, and mods mapped to the
+// same repo take the position of the highest priority mod. Mods without a
+// mapped version depend on any release version.
+func (p *MO2Profile) Import(m *Manifest, mapping MO2Mapping) (*MO2Import, error) {
+	mapping, err := mapping.normalize()
+	if err != nil {
+		return nil, err
+	}
+	if m.Dependency == nil {
+		m.Dependency = map[Repo]semver.String{}
+	}
+	imp := &MO2Import{Manifest: m}
+
+	priority := map[Repo]int{}
+	for i, mod := range p.Mods {
+		if !mod.Enabled {
+			continue
+		}
+
+		repo, version, ok, err := mapping.lookup(mod)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			imp.Unmapped = append(imp.Unmapped, mod)
+			continue
+		}
+
+		if _, exists := m.Dependency[repo]; !exists || version != mo2AnyVersion {
+			m.Dependency[repo] = version
+		}
+		priority[repo] = i
+		imp.Mapped = append(imp.Mapped, &MO2MappedMod{Name: mod.Name, Repo: repo, Version: version})
+	}
+
+	var order []Repo
+	for repo := range priority {
+		order = append(order, repo)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return priority[order[i]] < priority[order[j]]
+	})
+	m.Priority = order
+	return imp, nil
+}
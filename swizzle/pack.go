@@ -0,0 +1,246 @@
+package swizzle
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sevenZipCommands are the 7-Zip command line programs used to create 7z
+// archives, in order of preference.
+var sevenZipCommands = []string{"7z", "7zz", "7za"}
+
+// PackOptions selects the files added to a release archive. Patterns use
+// path.Match syntax. Patterns without a slash match any file or directory
+// name, and patterns with a slash match the path relative to the mod folder.
+type PackOptions struct {
+	// Include is the files to add. Default is every file.
+	Include []string
+
+	// Exclude is the files to leave out, even when included.
+	Exclude []string
+}
+
+// PackResult is a release archive created from a mod folder.
+type PackResult struct {
+	// Archive is the created archive location.
+	Archive string `json:"archive"`
+
+	// Files is every packed file, relative to the mod folder.
+	Files []string `json:"files"`
+
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+}
+
+// Pack creates a zip or 7z release archive from the files in a mod folder,
+// chosen by the out file extension. 7z archives are created with the 7-Zip
+// command line program. The archive is written to a temporary file first, so
+// a failed pack never replaces an existing archive.
+func Pack(dir, out string, opts PackOptions) (*PackResult, error) {
+	for _, p := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, NewError(ErrCodeInvalidInput, "", "", fmt.Errorf("invalid pattern '%s'", p))
+		}
+	}
+
+	var write func(dir, file string, files []string) error
+	switch strings.ToLower(filepath.Ext(out)) {
+	case string(ZipFileExtension):
+		write = writeZip
+	case string(SevenZFileExtension):
+		write = writeSevenZip
+	default:
+		return nil, NewError(ErrCodeInvalidInput, "", "", fmt.Errorf("unsupported archive '%s', must be %s or %s", out, ZipFileExtension, SevenZFileExtension))
+	}
+
+	out, err := filepath.Abs(out)
+	if err != nil {
+		return nil, err
+	}
+	files, err := packFiles(dir, out, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, NewError(ErrCodeInvalidInput, "", "", fmt.Errorf("no files to pack in '%s'", dir))
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(out), ".pack-*"+filepath.Ext(out))
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := write(dir, tmp.Name(), files); err != nil {
+		return nil, err
+	}
+	hash, size, err := hashFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	// temp files are only readable by the owner
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), out); err != nil {
+		return nil, err
+	}
+
+	return &PackResult{
+		Archive: out,
+		Files:   files,
+		Size:    size,
+		Hash:    releaseHashPrefix + hash,
+	}, nil
+}
+
+// packFiles returns the slash separated path of every file in the mod folder
+// selected by the pack options, in lexical order. The out file is skipped when
+// it is inside the folder.
+func packFiles(dir, out string, opts PackOptions) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if matchPack(opts.Exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		if abs, err := filepath.Abs(p); err == nil && abs == out {
+			return nil
+		}
+		if len(opts.Include) > 0 && !matchPack(opts.Include, rel) {
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+// matchPack checks whether any pattern matches a path, or one of its parent
+// directories. Patterns without a slash are matched against each path
+// element.
+func matchPack(patterns []string, rel string) bool {
+	parts := strings.Split(rel, "/")
+	for _, p := range patterns {
+		p = strings.Trim(filepath.ToSlash(p), "/")
+		for i := range parts {
+			name := parts[i]
+			if strings.Contains(p, "/") {
+				name = strings.Join(parts[:i+1], "/")
+			}
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeZip writes the files to a zip archive.
+func writeZip(dir, file string, files []string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for _, name := range files {
+		if err := addZipFile(zw, filepath.Join(dir, filepath.FromSlash(name)), name); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// addZipFile compresses a file into a zip archive.
+func addZipFile(zw *zip.Writer, file, name string) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	hdr.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	return err
+}
+
+// writeSevenZip writes the files to a 7z archive with the 7-Zip command line
+// program, passing the file names in a list file.
+func writeSevenZip(dir, file string, files []string) error {
+	var bin string
+	for _, name := range sevenZipCommands {
+		if p, err := exec.LookPath(name); err == nil {
+			bin = p
+			break
+		}
+	}
+	if bin == "" {
+		return NewError(ErrCodeNotFound, "", "", fmt.Errorf("creating 7z archives requires the 7-Zip command line program (%s)", strings.Join(sevenZipCommands, ", ")))
+	}
+
+	list, err := ioutil.TempFile("", "swizzle-pack-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(list.Name())
+	if _, err := list.WriteString(strings.Join(files, "\n") + "\n"); err != nil {
+		list.Close()
+		return err
+	}
+	if err := list.Close(); err != nil {
+		return err
+	}
+
+	// 7-Zip adds to an existing archive, so the empty temporary file is
+	// removed first
+	if err := os.Remove(file); err != nil {
+		return err
+	}
+	cmd := exec.Command(bin, "a", "-t7z", "-y", "-scsUTF-8", file, "@"+list.Name())
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("7-Zip failed: %s: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package swizzle
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// caseResolver resolves paths against existing directories case insensitively,
+// so content written for case insensitive file systems merges with existing
+// directories on case sensitive file systems.
+type caseResolver struct {
+	base    string
+	entries map[string]map[string]string
+}
+
+// newCaseResolver creates a caseResolver for paths relative to base.
+func newCaseResolver(base string) *caseResolver {
+	return &caseResolver{
+		base:    filepath.Clean(base),
+		entries: map[string]map[string]string{},
+	}
+}
+
+// Resolve returns the path for rel inside the resolver base directory, using
+// the casing of any existing file or directory for each path component. Parent
+// directory components never resolve outside the base directory.
+func (c *caseResolver) Resolve(rel string) string {
+	dir := c.base
+	for _, p := range strings.Split(cleanPath(filepath.ToSlash(rel)), "/") {
+		if p == "" {
+			continue
+		}
+
+		names := c.list(dir)
+		name, ok := names[strings.ToLower(p)]
+		if !ok {
+			name = p
+			names[strings.ToLower(p)] = p
+		}
+		dir = filepath.Join(dir, name)
+	}
+	return dir
+}
+
+// list returns the directory entries for dir by lower case name.
+func (c *caseResolver) list(dir string) map[string]string {
+	if names, ok := c.entries[dir]; ok {
+		return names
+	}
+
+	names := map[string]string{}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		lower := strings.ToLower(e.Name())
+		if _, ok := names[lower]; !ok {
+			names[lower] = e.Name()
+		}
+	}
+	c.entries[dir] = names
+	return names
+}
+
+// ResolvePathCase returns the path for rel inside the base directory, reusing the
+// casing of existing files and directories for each path component.
+func ResolvePathCase(base, rel string) string {
+	return newCaseResolver(base).Resolve(rel)
+}
+
+// CaseFix is a file or directory merged with another path differing only by case.
+type CaseFix struct {
+	// From is the path which was merged.
+	From string `json:"from"`
+
+	// To is the path From was merged into.
+	To string `json:"to"`
+
+	// Replaced is true when To was an existing file replaced by From.
+	Replaced bool `json:"replaced,omitempty"`
+}
+
+// FixCase merges all files and directories in dir which have names differing
+// only by case. Directories are merged into the casing with the most files.
+// When two files conflict the most recently modified file is kept. With dryRun
+// set the fixes are returned without changing any files.
+func FixCase(dir string, dryRun bool) ([]CaseFix, error) {
+	var fixes []CaseFix
+	err := fixCase(filepath.Clean(dir), dryRun, &fixes)
+	return fixes, err
+}
+
+// fixCase merges case conflicts in a single directory, and then recurses into
+// all child directories.
+func fixCase(dir string, dryRun bool, fixes *[]CaseFix) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	groups := map[string][]os.DirEntry{}
+	var keys []string
+	for _, e := range entries {
+		lower := strings.ToLower(e.Name())
+		if _, ok := groups[lower]; !ok {
+			keys = append(keys, lower)
+		}
+		groups[lower] = append(groups[lower], e)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		group := groups[k]
+		if len(group) > 1 {
+			target := caseTarget(dir, group)
+			for _, e := range group {
+				if e.Name() == target.Name() {
+					continue
+				}
+				err := mergePath(filepath.Join(dir, e.Name()), filepath.Join(dir, target.Name()), dryRun, fixes)
+				if err != nil {
+					return err
+				}
+			}
+			group = []os.DirEntry{target}
+		}
+
+		if group[0].IsDir() {
+			if err := fixCase(filepath.Join(dir, group[0].Name()), dryRun, fixes); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// caseTarget returns the entry other entries with the same name are merged
+// into. Directories are preferred over files, then directories with more files,
+// then the most recently modified file.
+func caseTarget(dir string, group []os.DirEntry) os.DirEntry {
+	best := group[0]
+	bestScore := caseScore(dir, best)
+	for _, e := range group[1:] {
+		if score := caseScore(dir, e); score > bestScore {
+			best, bestScore = e, score
+		}
+	}
+	return best
+}
+
+// caseScore ranks an entry for caseTarget.
+func caseScore(dir string, e os.DirEntry) int64 {
+	path := filepath.Join(dir, e.Name())
+	if e.IsDir() {
+		var n int64
+		filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				n++
+			}
+			return nil
+		})
+		// directories always rank above files
+		return 1<<62 + n
+	}
+
+	info, err := e.Info()
+	if err != nil {
+		return 0
+	}
+	return info.ModTime().UnixNano()
+}
+
+// mergePath moves from into to. Directory contents are merged recursively,
+// resolving names case insensitively against the target directory.
+func mergePath(from, to string, dryRun bool, fixes *[]CaseFix) error {
+	fromInfo, err := os.Lstat(from)
+	if err != nil {
+		return err
+	}
+	toInfo, err := os.Lstat(to)
+	if os.IsNotExist(err) {
+		*fixes = append(*fixes, CaseFix{From: from, To: to})
+		if dryRun {
+			return nil
+		}
+		return os.Rename(from, to)
+	}
+	if err != nil {
+		return err
+	}
+
+	if fromInfo.IsDir() && toInfo.IsDir() {
+		entries, err := os.ReadDir(from)
+		if err != nil {
+			return err
+		}
+
+		resolver := newCaseResolver(to)
+		for _, e := range entries {
+			target := resolver.Resolve(e.Name())
+			if err := mergePath(filepath.Join(from, e.Name()), target, dryRun, fixes); err != nil {
+				return err
+			}
+		}
+
+		if dryRun {
+			return nil
+		}
+		return os.Remove(from)
+	}
+
+	if fromInfo.IsDir() || toInfo.IsDir() {
+		// a file and a directory with the same name; keep the directory
+		if fromInfo.IsDir() {
+			from, to = to, from
+		}
+		*fixes = append(*fixes, CaseFix{From: from, To: to})
+		if dryRun {
+			return nil
+		}
+		return os.Remove(from)
+	}
+
+	if fromInfo.ModTime().Before(toInfo.ModTime()) {
+		*fixes = append(*fixes, CaseFix{From: from, To: to})
+		if dryRun {
+			return nil
+		}
+		return os.Remove(from)
+	}
+
+	*fixes = append(*fixes, CaseFix{From: from, To: to, Replaced: true})
+	if dryRun {
+		return nil
+	}
+	return os.Rename(from, to)
+}
+
+// lowerPath returns the slash separated lower case path, for comparing paths
+// case insensitively.
+func lowerPath(path string) string {
+	return strings.ToLower(filepath.ToSlash(path))
+}
+
+// cleanPath converts a relative path, which may use Windows separators, to a
+// clean slash separated relative path.
+func cleanPath(p string) string {
+	p = path.Clean("/" + strings.ReplaceAll(p, `\`, "/"))
+	return strings.TrimPrefix(p, "/")
+}
@@ -0,0 +1,256 @@
+package swizzle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Plugin record flags in the TES4 header.
+const (
+	// PluginMasterFlag marks a master plugin (ESM).
+	PluginMasterFlag uint32 = 0x1
+
+	// PluginLightFlag marks a light plugin (ESL), which does not use a full
+	// load order slot.
+	PluginLightFlag uint32 = 0x200
+)
+
+// maxPluginHeader is the largest TES4 record accepted when reading a plugin.
+const maxPluginHeader uint32 = 16 << 20
+
+// pluginExtensions are the file extensions for Bethesda plugins.
+var pluginExtensions = map[string]bool{
+	".esm": true,
+	".esp": true,
+	".esl": true,
+}
+
+// Plugin is the header of a Bethesda plugin file, read from the TES4 record.
+type Plugin struct {
+	// Name is the plugin file name.
+	Name string `json:"name"`
+
+	// Flags is the TES4 record flags.
+	Flags uint32 `json:"flags"`
+
+	// Version is the plugin format version from the HEDR subrecord.
+	Version float32 `json:"version"`
+
+	Author      string `json:"author,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Masters is every plugin this plugin depends on, in load order.
+	Masters []string `json:"masters"`
+}
+
+// IsPlugin checks whether a file name has a Bethesda plugin file extension.
+func IsPlugin(name string) bool {
+	return pluginExtensions[strings.ToLower(path.Ext(filepath.ToSlash(name)))]
+}
+
+// Master is true when the plugin is flagged as a master or has the .esm
+// extension.
+func (p *Plugin) Master() bool {
+	return p.Flags&PluginMasterFlag != 0 || strings.EqualFold(path.Ext(p.Name), ".esm")
+}
+
+// Light is true when the plugin is flagged as light or has the .esl extension.
+func (p *Plugin) Light() bool {
+	return p.Flags&PluginLightFlag != 0 || strings.EqualFold(path.Ext(p.Name), ".esl")
+}
+
+// ReadPlugin parses the plugin header from a plugin file on the file system.
+func ReadPlugin(file string) (*Plugin, error) {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p, err := ParsePlugin(f, filepath.Base(file))
+	if err != nil {
+		return nil, fmt.Errorf("'%s': %w", filepath.Base(file), err)
+	}
+	return p, nil
+}
+
+// ParsePlugin parses the TES4 record at the start of a plugin. Oblivion
+// plugins use a 20 byte record header, later games a 24 byte header.
+func ParsePlugin(r io.Reader, name string) (*Plugin, error) {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("invalid plugin header: %s", err)
+	}
+	if string(hdr[:4]) != "TES4" {
+		return nil, fmt.Errorf("invalid plugin header: missing TES4 record")
+	}
+
+	size := binary.LittleEndian.Uint32(hdr[4:8])
+	if size > maxPluginHeader {
+		return nil, fmt.Errorf("invalid plugin header: TES4 record too large")
+	}
+
+	p := &Plugin{
+		Name:  name,
+		Flags: binary.LittleEndian.Uint32(hdr[8:12]),
+	}
+
+	// Oblivion records have no version fields, so the first subrecord
+	// starts at byte 20
+	hdrLen := uint32(24)
+	if string(hdr[20:24]) == "HEDR" {
+		hdrLen = 20
+	}
+
+	data := make([]byte, size)
+	n := copy(data, hdr[hdrLen:])
+	if _, err := io.ReadFull(r, data[n:]); err != nil {
+		return nil, fmt.Errorf("invalid plugin header: %s", err)
+	}
+
+	if err := p.parseSubrecords(data); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parseSubrecords reads the subrecords in the TES4 record data.
+func (p *Plugin) parseSubrecords(data []byte) error {
+	var next uint32
+	for len(data) > 0 {
+		if len(data) < 6 {
+			return fmt.Errorf("invalid plugin header: truncated subrecord")
+		}
+
+		typ := string(data[:4])
+		size := uint32(binary.LittleEndian.Uint16(data[4:6]))
+		data = data[6:]
+
+		// XXXX holds the size of the next subrecord when it is too large
+		// for the 16 bit size field
+		if next > 0 {
+			size, next = next, 0
+		}
+		if uint32(len(data)) < size {
+			return fmt.Errorf("invalid plugin header: truncated %s subrecord", typ)
+		}
+		field := data[:size]
+		data = data[size:]
+
+		switch typ {
+		case "XXXX":
+			if len(field) < 4 {
+				return fmt.Errorf("invalid plugin header: truncated XXXX subrecord")
+			}
+			next = binary.LittleEndian.Uint32(field)
+		case "HEDR":
+			if len(field) >= 4 {
+				p.Version = math.Float32frombits(binary.LittleEndian.Uint32(field))
+			}
+		case "CNAM":
+			p.Author = zstring(field)
+		case "SNAM":
+			p.Description = zstring(field)
+		case "MAST":
+			p.Masters = append(p.Masters, zstring(field))
+		}
+	}
+	return nil
+}
+
+// zstring returns the null terminated string in b.
+func zstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// MissingMaster is a master required by a deployed plugin which is not
+// provided by any mod or the base game.
+type MissingMaster struct {
+	Plugin string `json:"plugin"`
+	Repo   Repo   `json:"repo"`
+	Master string `json:"master"`
+}
+
+// UnreadablePlugin is a plugin with a header which could not be read, so the
+// plugin was skipped.
+type UnreadablePlugin struct {
+	Plugin string `json:"plugin"`
+	Repo   Repo   `json:"repo,omitempty"`
+	Error  string `json:"error"`
+}
+
+// MissingMasters reads the header of every plugin in the plan, and returns
+// each master which is not provided by a plugin in the plan or a plugin in the
+// game Data directory. Plugins deployed by the current deployment are not
+// counted as part of the base game. Plugins which cannot be read are returned
+// as unreadable, and their masters are not checked.
+func (s *Staging) MissingMasters(g *GameConfig, p *Plan) ([]*MissingMaster, []*UnreadablePlugin, error) {
+	d, err := s.Deployment()
+	if err != nil {
+		return nil, nil, err
+	}
+	deployed := map[DeployedPath]bool{}
+	for _, f := range d.Files {
+		deployed[pathKey(f.Root, f.Path)] = true
+	}
+
+	provided := map[string]bool{}
+	dataDir := newCaseResolver(g.GameDir()).Resolve("Data")
+	entries, err := os.ReadDir(dataDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	for _, e := range entries {
+		rel := path.Join(filepath.Base(dataDir), e.Name())
+		if !e.IsDir() && IsPlugin(e.Name()) && !deployed[pathKey(GameRoot, rel)] {
+			provided[strings.ToLower(e.Name())] = true
+		}
+	}
+
+	var plugins []*StagedFile
+	for _, f := range p.Files {
+		if f.Root == GameRoot && lowerPath(path.Dir(f.Path)) == "data" && IsPlugin(f.Path) {
+			provided[strings.ToLower(path.Base(f.Path))] = true
+			plugins = append(plugins, f)
+		}
+	}
+
+	var missing []*MissingMaster
+	var unreadable []*UnreadablePlugin
+	for _, f := range plugins {
+		plugin, err := ReadPlugin(f.Source)
+		if err != nil {
+			unreadable = append(unreadable, &UnreadablePlugin{
+				Plugin: path.Base(f.Path),
+				Repo:   f.Repo,
+				Error:  err.Error(),
+			})
+			continue
+		}
+		for _, m := range plugin.Masters {
+			if !provided[strings.ToLower(m)] {
+				missing = append(missing, &MissingMaster{
+					Plugin: path.Base(f.Path),
+					Repo:   f.Repo,
+					Master: m,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(missing, func(i, j int) bool {
+		return strings.ToLower(missing[i].Plugin) < strings.ToLower(missing[j].Plugin)
+	})
+	return missing, unreadable, nil
+}
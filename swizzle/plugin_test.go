@@ -0,0 +1,187 @@
+package swizzle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// subrecord encodes a plugin subrecord with a 16 bit size.
+func subrecord(typ string, data []byte) []byte {
+	b := make([]byte, 6, 6+len(data))
+	copy(b, typ)
+	binary.LittleEndian.PutUint16(b[4:6], uint16(len(data)))
+	return append(b, data...)
+}
+
+// pluginRecord encodes a TES4 record. Oblivion records use a 20 byte header.
+func pluginRecord(oblivion bool, flags uint32, subs ...[]byte) []byte {
+	data := bytes.Join(subs, nil)
+	hdrLen := 24
+	if oblivion {
+		hdrLen = 20
+	}
+	b := make([]byte, hdrLen, hdrLen+len(data))
+	copy(b, "TES4")
+	binary.LittleEndian.PutUint32(b[4:8], uint32(len(data)))
+	binary.LittleEndian.PutUint32(b[8:12], flags)
+	return append(b, data...)
+}
+
+// hedr encodes a HEDR subrecord for a plugin format version.
+func hedr(version float32) []byte {
+	data := make([]byte, 12)
+	binary.LittleEndian.PutUint32(data, math.Float32bits(version))
+	return subrecord("HEDR", data)
+}
+
+func TestParsePlugin(t *testing.T) {
+	xxxx := make([]byte, 4)
+	binary.LittleEndian.PutUint32(xxxx, 3)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		plugin *Plugin
+		err    string
+	}{
+		{
+			name: "skyrim",
+			data: pluginRecord(false, PluginMasterFlag,
+				hedr(1.7),
+				subrecord("CNAM", []byte("author\x00")),
+				subrecord("SNAM", []byte("description\x00")),
+				subrecord("MAST", []byte("Skyrim.esm\x00")),
+				subrecord("DATA", make([]byte, 8)),
+				subrecord("MAST", []byte("Update.esm\x00")),
+				subrecord("DATA", make([]byte, 8)),
+			),
+			plugin: &Plugin{
+				Flags:       PluginMasterFlag,
+				Version:     1.7,
+				Author:      "author",
+				Description: "description",
+				Masters:     []string{"Skyrim.esm", "Update.esm"},
+			},
+		},
+		{
+			name: "oblivion header",
+			data: pluginRecord(true, 0,
+				hedr(0.8),
+				subrecord("MAST", []byte("Oblivion.esm\x00")),
+			),
+			plugin: &Plugin{Version: 0.8, Masters: []string{"Oblivion.esm"}},
+		},
+		{
+			name: "oblivion header without subrecords after HEDR",
+			data: pluginRecord(true, PluginLightFlag, hedr(1.0)),
+			plugin: &Plugin{
+				Flags:   PluginLightFlag,
+				Version: 1.0,
+			},
+		},
+		{
+			name: "XXXX sets the next subrecord size",
+			data: pluginRecord(false, 0,
+				hedr(1.7),
+				subrecord("XXXX", xxxx),
+				subrecord("SNAM", nil),
+				[]byte("ab\x00"),
+				subrecord("MAST", []byte("Skyrim.esm\x00")),
+			),
+			plugin: &Plugin{
+				Version:     1.7,
+				Description: "ab",
+				Masters:     []string{"Skyrim.esm"},
+			},
+		},
+		{
+			name: "not a plugin",
+			data: append([]byte("TES3"), make([]byte, 20)...),
+			err:  "missing TES4 record",
+		},
+		{
+			name: "short header",
+			data: []byte("TES4"),
+			err:  "invalid plugin header",
+		},
+		{
+			name: "record too large",
+			data: func() []byte {
+				b := pluginRecord(false, 0)
+				binary.LittleEndian.PutUint32(b[4:8], maxPluginHeader+1)
+				return b
+			}(),
+			err: "TES4 record too large",
+		},
+		{
+			name: "truncated record",
+			data: func() []byte {
+				b := pluginRecord(false, 0, hedr(1.7))
+				return b[:len(b)-2]
+			}(),
+			err: "invalid plugin header",
+		},
+		{
+			name: "truncated subrecord",
+			data: pluginRecord(false, 0, hedr(1.7), []byte("MAST")),
+			err:  "truncated subrecord",
+		},
+		{
+			name: "truncated subrecord data",
+			data: pluginRecord(false, 0, hedr(1.7), subrecord("MAST", []byte("Skyrim.esm"))[:10]),
+			err:  "truncated MAST subrecord",
+		},
+		{
+			name: "truncated XXXX",
+			data: pluginRecord(false, 0, hedr(1.7), subrecord("XXXX", []byte{1, 0})),
+			err:  "truncated XXXX subrecord",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePlugin(bytes.NewReader(tt.data), "test.esp")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.plugin.Name = "test.esp"
+			if !reflect.DeepEqual(p, tt.plugin) {
+				t.Errorf("got %+v, want %+v", p, tt.plugin)
+			}
+		})
+	}
+}
+
+func TestPluginMasterLight(t *testing.T) {
+	tests := []struct {
+		name   string
+		flags  uint32
+		master bool
+		light  bool
+	}{
+		{"Mod.esp", 0, false, false},
+		{"Mod.esp", PluginMasterFlag, true, false},
+		{"Mod.ESM", 0, true, false},
+		{"Mod.esl", 0, false, true},
+		{"Mod.esp", PluginLightFlag, false, true},
+		{"Mod.esm", PluginLightFlag, true, true},
+	}
+
+	for _, tt := range tests {
+		p := &Plugin{Name: tt.name, Flags: tt.flags}
+		if p.Master() != tt.master || p.Light() != tt.light {
+			t.Errorf("%s flags %#x: got master %v light %v, want master %v light %v", tt.name, tt.flags, p.Master(), p.Light(), tt.master, tt.light)
+		}
+	}
+}
@@ -0,0 +1,479 @@
+package swizzle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/afloesch/semver"
+)
+
+const profileDir string = "profiles"
+const activeProfileName string = "active"
+
+// Profile is a named set of enabled manifest dependencies, with its own
+// plugin load order and INI tweaks.
+type Profile struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+
+	// Mods is the manifest dependencies enabled by the profile. The
+	// dependencies of enabled mods are always enabled.
+	Mods []Repo `json:"mods"`
+
+	// INI is the INI tweaks applied after the manifest INI tweaks.
+	INI []*INITweak `json:"ini,omitempty"`
+
+	// LoadOrder is the plugin order and enabled state saved when the
+	// profile was last active.
+	LoadOrder []*LoadOrderPlugin `json:"loadOrder,omitempty"`
+}
+
+// ProfileDiff is the difference between two profiles.
+type ProfileDiff struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// Added and Removed are the mods enabled only in the to and from
+	// profiles.
+	Added   []Repo `json:"added"`
+	Removed []Repo `json:"removed"`
+
+	// INI is every INI key set differently by the profiles.
+	INI []*ProfileINIDiff `json:"ini"`
+
+	// Plugins is every plugin enabled in only one of the profiles.
+	Plugins []*ProfilePluginDiff `json:"plugins"`
+}
+
+// ProfileINIDiff is an INI key set differently by two profiles. A nil value
+// is a key the profile does not set.
+type ProfileINIDiff struct {
+	File    string      `json:"file"`
+	Root    InstallRoot `json:"root"`
+	Section string      `json:"section"`
+	Key     string      `json:"key"`
+	From    *string     `json:"from"`
+	To      *string     `json:"to"`
+}
+
+// ProfilePluginDiff is a plugin enabled in only one of two profiles.
+type ProfilePluginDiff struct {
+	Name string `json:"name"`
+	From bool   `json:"from"`
+	To   bool   `json:"to"`
+}
+
+// profilePath returns the record location for a named profile.
+func (s *Staging) profilePath(name string) string {
+	return filepath.Join(s.Dir, profileDir, name+".json")
+}
+
+// validateProfileName checks a profile name can be used as a file name.
+func validateProfileName(name string) error {
+	if name == "" || name == "." || name == ".." || name == activeProfileName || strings.ContainsAny(name, `/\:`) {
+		return NewError(ErrCodeInvalidInput, "", "", fmt.Errorf("invalid profile name '%s'", name))
+	}
+	return nil
+}
+
+// ValidateProfile checks a new profile has a valid name which is not in use,
+// only enables manifest dependencies, and has valid INI tweaks.
+func (s *Staging) ValidateProfile(m *Manifest, p *Profile) error {
+	if err := validateProfileName(p.Name); err != nil {
+		return err
+	}
+	if _, err := os.Stat(s.profilePath(p.Name)); err == nil {
+		return NewError(ErrCodeInvalidInput, "", "", fmt.Errorf("profile '%s' already exists", p.Name))
+	}
+
+	for _, repo := range p.Mods {
+		if _, ok := m.Dependency[repo]; !ok {
+			return NewError(ErrCodeInvalidInput, repo, "", fmt.Errorf("'%s' is not a manifest dependency", repo))
+		}
+	}
+	for _, t := range p.INI {
+		if err := t.validate(""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateProfile saves a new profile. Every profile mod must be a dependency of
+// the manifest, and the mods are sorted by name.
+func (s *Staging) CreateProfile(m *Manifest, p *Profile) error {
+	if err := s.ValidateProfile(m, p); err != nil {
+		return err
+	}
+	sort.Slice(p.Mods, func(i, j int) bool {
+		return p.Mods[i] < p.Mods[j]
+	})
+
+	if p.Created.IsZero() {
+		p.Created = time.Now().UTC()
+	}
+	return s.writeProfile(p)
+}
+
+// writeProfile saves a profile record to the staging directory.
+func (s *Staging) writeProfile(p *Profile) error {
+	if err := os.MkdirAll(filepath.Join(s.Dir, profileDir), 0755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.profilePath(p.Name), b, 0644)
+}
+
+// Profile reads a named profile.
+func (s *Staging) Profile(name string) (*Profile, error) {
+	if err := validateProfileName(name); err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(s.profilePath(name))
+	if os.IsNotExist(err) {
+		return nil, NewError(ErrCodeNotFound, "", "", fmt.Errorf("profile '%s' not found", name))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var p Profile
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("invalid profile '%s': %s", name, err)
+	}
+	return &p, nil
+}
+
+// Profiles returns all profiles in the staging directory, sorted by name.
+func (s *Staging) Profiles() ([]*Profile, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Dir, profileDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []*Profile
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		p, err := s.Profile(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+
+	sort.SliceStable(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles, nil
+}
+
+// ActiveProfile returns the profile deployed to the game, or nil when no
+// profile is in use.
+func (s *Staging) ActiveProfile() (*Profile, error) {
+	b, err := ioutil.ReadFile(filepath.Join(s.Dir, profileDir, activeProfileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(string(b))
+	if name == "" {
+		return nil, nil
+	}
+	return s.Profile(name)
+}
+
+// SetActiveProfile records the profile deployed to the game. The current load
+// order is saved to the previously active profile first, so switching back
+// restores it.
+func (s *Staging) SetActiveProfile(g *GameConfig, p *Profile) error {
+	prev, err := s.ActiveProfile()
+	if err != nil {
+		return err
+	}
+	if prev != nil {
+		if err := s.SaveProfileLoadOrder(g, prev); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(s.Dir, profileDir), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.Dir, profileDir, activeProfileName), []byte(p.Name+"\n"), 0644)
+}
+
+// SaveProfileLoadOrder saves the current game load order to a profile.
+func (s *Staging) SaveProfileLoadOrder(g *GameConfig, p *Profile) error {
+	plugins, err := readLoadOrderFiles(g)
+	if err != nil {
+		return err
+	}
+	p.LoadOrder = plugins
+	return s.writeProfile(p)
+}
+
+// Apply returns the manifest and locked mods for deploying the profile. Only
+// the profile mods and their dependencies are kept, in lock order, overrides
+// for other mods are dropped, and the profile INI tweaks are added after the
+// manifest INI tweaks. Dependencies are read from the staged release records,
+// or from the release manifests in the graph for mods not yet staged or
+// staged before dependencies were recorded. The graph may be nil.
+func (p *Profile) Apply(s *Staging, m *Manifest, mods []*LockedMod, graph *Graph) (*Manifest, []*LockedMod, error) {
+	versions := map[Repo]*LockedMod{}
+	for _, mod := range mods {
+		versions[mod.Repo] = mod
+	}
+
+	enabled := map[Repo]bool{}
+	queue := append([]Repo{}, p.Mods...)
+	for len(queue) > 0 {
+		repo := queue[0]
+		queue = queue[1:]
+		if enabled[repo] {
+			continue
+		}
+
+		mod, ok := versions[repo]
+		if !ok {
+			return nil, nil, NewError(ErrCodeNotFound, repo, "", fmt.Errorf("profile '%s' mod '%s' is not installed", p.Name, repo))
+		}
+		enabled[repo] = true
+
+		var deps []Repo
+		if s.IsStaged(mod.Repo, mod.Version) {
+			r, err := s.Release(mod.Repo, mod.Version)
+			if err != nil {
+				return nil, nil, err
+			}
+			deps = r.Dependency
+		}
+		if deps == nil {
+			var ok bool
+			if deps, ok = graph.dependencies(mod); !ok {
+				return nil, nil, NewError(ErrCodeNotFound, mod.Repo, string(mod.Version), fmt.Errorf("staged release %s %s has no dependency data, restage it with 'swizzle install --restage'", mod.Repo, mod.Version))
+			}
+		}
+		queue = append(queue, deps...)
+	}
+
+	var kept []*LockedMod
+	for _, mod := range mods {
+		if enabled[mod.Repo] {
+			kept = append(kept, mod)
+		}
+	}
+
+	pm := *m
+	pm.INI = append(append([]*INITweak{}, m.INI...), p.INI...)
+	pm.Dependency = map[Repo]semver.String{}
+	for repo, v := range m.Dependency {
+		if enabled[repo] {
+			pm.Dependency[repo] = v
+		}
+	}
+	pm.Overrides = map[string]Repo{}
+	for k, repo := range m.Overrides {
+		if enabled[repo] {
+			pm.Overrides[k] = repo
+		}
+	}
+	return &pm, kept, nil
+}
+
+// WriteProfileLoadOrder writes the load order files for a profile. The saved
+// profile load order is written first, so base game plugins keep the profile
+// order, then the load order is sorted and every plugin in the saved load
+// order keeps its enabled state.
+func (s *Staging) WriteProfileLoadOrder(g *GameConfig, p *Profile) (*LoadOrder, error) {
+	d, err := s.Deployment()
+	if err != nil {
+		return nil, err
+	}
+	return s.writeProfileLoadOrder(g, p, d)
+}
+
+// writeProfileLoadOrder writes the load order files for a profile and a
+// deployment.
+func (s *Staging) writeProfileLoadOrder(g *GameConfig, p *Profile, d *Deployment) (*LoadOrder, error) {
+	if len(p.LoadOrder) > 0 {
+		dir, err := g.RootDir(AppDataRoot)
+		if err != nil {
+			return nil, err
+		}
+		saved := &LoadOrder{Plugins: p.LoadOrder}
+		if err := saved.WriteFiles(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	lo, err := s.writeLoadOrder(g, d)
+	if err != nil || len(p.LoadOrder) == 0 || len(lo.Plugins) == 0 {
+		return lo, err
+	}
+
+	enabled := map[string]bool{}
+	for _, pl := range p.LoadOrder {
+		enabled[strings.ToLower(pl.Name)] = pl.Enabled
+	}
+	for _, pl := range lo.Plugins {
+		if e, ok := enabled[strings.ToLower(pl.Name)]; ok {
+			pl.Enabled = e
+		}
+	}
+
+	dir, err := g.RootDir(AppDataRoot)
+	if err != nil {
+		return nil, err
+	}
+	return lo, lo.WriteFiles(dir)
+}
+
+// UseProfile records the profile as the active profile, and writes the
+// profile load order for the deployment created by the transaction. The
+// active profile record, the previous profile and the load order files are
+// restored on rollback.
+func (t *Transaction) UseProfile(p *Profile) (*LoadOrder, error) {
+	if err := t.saveLoadOrder(); err != nil {
+		return nil, err
+	}
+	prev, err := t.staging.ActiveProfile()
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil {
+		if err := t.save(t.staging.profilePath(prev.Name)); err != nil {
+			return nil, err
+		}
+	}
+	if err := t.save(filepath.Join(t.staging.Dir, profileDir, activeProfileName)); err != nil {
+		return nil, err
+	}
+
+	// the previous profile keeps its load order, and the profile is read
+	// again in case it was the previous profile
+	if err := t.staging.SetActiveProfile(t.game, p); err != nil {
+		return nil, err
+	}
+	if p, err = t.staging.Profile(p.Name); err != nil {
+		return nil, err
+	}
+	return t.staging.writeProfileLoadOrder(t.game, p, t.deployment())
+}
+
+// Diff returns the mods, INI tweaks and enabled plugins which differ between
+// two profiles.
+func (p *Profile) Diff(to *Profile) *ProfileDiff {
+	d := &ProfileDiff{
+		From:    p.Name,
+		To:      to.Name,
+		Added:   []Repo{},
+		Removed: []Repo{},
+		INI:     []*ProfileINIDiff{},
+		Plugins: []*ProfilePluginDiff{},
+	}
+
+	from := map[Repo]bool{}
+	for _, r := range p.Mods {
+		from[r] = true
+	}
+	for _, r := range to.Mods {
+		if !from[r] {
+			d.Added = append(d.Added, r)
+		}
+		delete(from, r)
+	}
+	for _, r := range p.Mods {
+		if from[r] {
+			d.Removed = append(d.Removed, r)
+		}
+	}
+
+	// the last tweak for a key wins, as when the tweaks are deployed
+	type iniValue struct {
+		tweak *INITweak
+		from  *string
+		to    *string
+	}
+	values := map[string]*iniValue{}
+	var keys []string
+	set := func(t *INITweak, isTo bool) {
+		k := t.key()
+		v, ok := values[k]
+		if !ok {
+			v = &iniValue{tweak: t}
+			values[k] = v
+			keys = append(keys, k)
+		}
+		value := strings.TrimSpace(t.Value)
+		if isTo {
+			v.to = &value
+		} else {
+			v.from = &value
+		}
+	}
+	for _, t := range p.INI {
+		set(t, false)
+	}
+	for _, t := range to.INI {
+		set(t, true)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := values[k]
+		if v.from != nil && v.to != nil && *v.from == *v.to {
+			continue
+		}
+		d.INI = append(d.INI, &ProfileINIDiff{
+			File:    v.tweak.File,
+			Root:    v.tweak.installRoot(),
+			Section: v.tweak.Section,
+			Key:     v.tweak.Key,
+			From:    v.from,
+			To:      v.to,
+		})
+	}
+
+	enabled := map[string]*ProfilePluginDiff{}
+	var names []string
+	plugin := func(pl *LoadOrderPlugin) *ProfilePluginDiff {
+		k := strings.ToLower(pl.Name)
+		pd, ok := enabled[k]
+		if !ok {
+			pd = &ProfilePluginDiff{Name: pl.Name}
+			enabled[k] = pd
+			names = append(names, k)
+		}
+		return pd
+	}
+	for _, pl := range p.LoadOrder {
+		plugin(pl).From = pl.Enabled
+	}
+	for _, pl := range to.LoadOrder {
+		plugin(pl).To = pl.Enabled
+	}
+	for _, k := range names {
+		if pd := enabled[k]; pd.From != pd.To {
+			d.Plugins = append(d.Plugins, pd)
+		}
+	}
+	return d
+}
@@ -0,0 +1,159 @@
+package swizzle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// InstallRoot is the base directory a ReleaseFile destination is relative to.
+type InstallRoot string
+
+const (
+	// GameRoot is the game install directory. This is the default root.
+	GameRoot InstallRoot = "game"
+
+	// DocumentsRoot is the game folder in the Windows user "Documents/My Games"
+	// directory, where Bethesda games keep INI files and saves.
+	DocumentsRoot InstallRoot = "documents"
+
+	// AppDataRoot is the game folder in the Windows user "AppData/Local"
+	// directory, where Bethesda games keep plugins.txt.
+	AppDataRoot InstallRoot = "appdata"
+)
+
+// protonUser is the Windows user name for all Proton prefixes.
+const protonUser string = "steamuser"
+
+// userDataNames are the Windows user data folder names for known games by
+// Steam app id.
+var userDataNames = map[string]string{
+	"22330":   "Oblivion",
+	"22370":   "Fallout3",
+	"22380":   "FalloutNV",
+	"72850":   "Skyrim",
+	"377160":  "Fallout4",
+	"489830":  "Skyrim Special Edition",
+	"611660":  "Fallout4VR",
+	"611670":  "Skyrim VR",
+	"1716740": "Starfield",
+}
+
+// ProtonPrefix returns the Proton Wine prefix for a Steam game, which is
+// steamapps/compatdata/<appid>/pfx in the Steam library the game is installed in.
+func ProtonPrefix(library, appID string) string {
+	return filepath.Join(library, "steamapps", "compatdata", appID, "pfx")
+}
+
+// InstallRoot returns the install root for the release file, which defaults to
+// the game directory.
+func (f *ReleaseFile) InstallRoot() InstallRoot {
+	if f.Root == "" {
+		return GameRoot
+	}
+	return f.Root
+}
+
+// validateRoot checks the release file installs to a known root.
+func (f *ReleaseFile) validateRoot(m *Manifest) error {
+	switch f.InstallRoot() {
+	case GameRoot, DocumentsRoot, AppDataRoot:
+		return nil
+	}
+	return NewError(ErrCodeInvalidInput, m.Repo, string(m.Version), fmt.Errorf("unknown install root '%s' for release file '%s'", f.Root, f.Name))
+}
+
+// SteamAppID returns the configured Steam app id for the game, or looks up the
+// app id from the Steam install matching the game directory.
+func (g *GameConfig) SteamAppID() string {
+	if g.AppID != "" {
+		return g.AppID
+	}
+
+	games, err := FindSteamGames()
+	if err != nil {
+		return ""
+	}
+	for _, s := range games {
+		if filepath.Clean(s.Directory) == filepath.Clean(g.GameDir()) {
+			return s.AppID
+		}
+	}
+	return ""
+}
+
+// PrefixDir returns the Proton prefix for the game. A configured prefix takes
+// precedence over the prefix in the Steam library for the game directory.
+func (g *GameConfig) PrefixDir() (string, error) {
+	if g.Prefix != "" {
+		return expandHome(g.Prefix), nil
+	}
+
+	appID := g.SteamAppID()
+	if appID == "" {
+		return "", fmt.Errorf("unknown Steam app id for game '%s'", g.Name)
+	}
+
+	// Steam games are installed to <library>/steamapps/common/<installdir>.
+	library := filepath.Dir(filepath.Dir(filepath.Dir(g.GameDir())))
+	return ProtonPrefix(library, appID), nil
+}
+
+// UserDataName returns the game folder name used in the Windows user Documents
+// and AppData directories.
+func (g *GameConfig) UserDataName() (string, error) {
+	if g.UserData != "" {
+		return g.UserData, nil
+	}
+
+	if name, ok := userDataNames[g.SteamAppID()]; ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown user data folder for game '%s'", g.Name)
+}
+
+// RootDir returns the directory on the system for an install root. On Linux the
+// Documents and AppData roots resolve to the Windows user profile inside the
+// Proton prefix for the game.
+func (g *GameConfig) RootDir(root InstallRoot) (string, error) {
+	if root == "" || root == GameRoot {
+		return g.GameDir(), nil
+	}
+
+	name, err := g.UserDataName()
+	if err != nil {
+		return "", err
+	}
+
+	var profile string
+	if runtime.GOOS == "windows" {
+		profile, err = os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+	} else {
+		prefix, err := g.PrefixDir()
+		if err != nil {
+			return "", err
+		}
+		profile = filepath.Join(prefix, "drive_c", "users", protonUser)
+	}
+
+	switch root {
+	case DocumentsRoot:
+		return filepath.Join(profile, "Documents", "My Games", name), nil
+	case AppDataRoot:
+		return filepath.Join(profile, "AppData", "Local", name), nil
+	}
+	return "", fmt.Errorf("unknown install root '%s'", root)
+}
+
+// Destination returns the directory on the system a release file is installed to.
+func (g *GameConfig) Destination(f *ReleaseFile) (string, error) {
+	dir, err := g.RootDir(f.InstallRoot())
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.FromSlash(cleanPath(f.Destination))), nil
+}
@@ -0,0 +1,233 @@
+package swizzle
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/afloesch/semver"
+	"github.com/google/go-github/v45/github"
+	"gopkg.in/yaml.v3"
+)
+
+// PublishOptions configures the GitHub release created by Publish.
+type PublishOptions struct {
+	// Dir is the directory containing the release files.
+	Dir string
+
+	// Target is the branch or commit the release tag is created from, when
+	// the tag does not exist. Default is the repository default branch.
+	Target string
+
+	// Notes is the release notes.
+	Notes string
+
+	Prerelease bool
+
+	// Draft leaves the release unpublished after the assets are uploaded.
+	Draft bool
+}
+
+// PublishedRelease is a GitHub release created by Publish.
+type PublishedRelease struct {
+	Repo    Repo          `json:"repo"`
+	Version semver.String `json:"version"`
+	URL     string        `json:"url"`
+	Draft   bool          `json:"draft"`
+
+	// Assets is every uploaded release asset, starting with the swiz.zle
+	// manifest.
+	Assets []*PublishedAsset `json:"assets"`
+}
+
+// PublishedAsset is a file uploaded to a GitHub release.
+type PublishedAsset struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Publish creates a GitHub release for the manifest version, tagged with the
+// version, and uploads the manifest as swiz.zle and every release file as
+// release assets. The release is created as a draft and only published once
+// every asset is uploaded with the expected name and size, so mods never
+// resolve a release with missing files. The draft is removed when publishing
+// fails.
+func (m *Manifest) Publish(ctx context.Context, opts PublishOptions) (*PublishedRelease, error) {
+	files, err := m.publishFiles(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if githubToken == "" {
+		return nil, NewError(ErrCodeInvalidInput, m.Repo, string(m.Version), fmt.Errorf("publishing a release requires a GitHub token"))
+	}
+
+	tag := m.Version.Get().String()
+	client := githubClient()
+	owner, name := m.Repo.Organization(), m.Repo.Name()
+
+	_, res, err := client.Repositories.GetReleaseByTag(ctx, owner, name, tag)
+	if err == nil {
+		return nil, NewError(ErrCodeInvalidInput, m.Repo, tag, fmt.Errorf("release '%s' already exists", tag))
+	}
+	if res == nil || res.StatusCode != http.StatusNotFound {
+		return nil, NewError(ErrCodeInvalidRepo, m.Repo, tag, err)
+	}
+
+	// the manifest is uploaded from a file named swiz.zle, which is the
+	// asset name consumers look for
+	tmp, err := ioutil.TempDir("", "swizzle-publish-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	content, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	manifest := filepath.Join(tmp, manifestName)
+	if err := os.WriteFile(manifest, content, 0644); err != nil {
+		return nil, err
+	}
+	files = append([]string{manifest}, files...)
+
+	rel, _, err := client.Repositories.CreateRelease(ctx, owner, name, &github.RepositoryRelease{
+		TagName:         github.String(tag),
+		TargetCommitish: stringOrNil(opts.Target),
+		Name:            github.String(tag),
+		Body:            github.String(opts.Notes),
+		Draft:           github.Bool(true),
+		Prerelease:      github.Bool(opts.Prerelease),
+	})
+	if err != nil {
+		return nil, NewError(ErrCodeInvalidRepo, m.Repo, tag, err)
+	}
+
+	p, err := m.publish(ctx, client, rel, files, opts)
+	if err != nil {
+		// the draft is removed even when the publish was interrupted
+		dctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if _, derr := client.Repositories.DeleteRelease(dctx, owner, name, rel.GetID()); derr != nil {
+			return nil, fmt.Errorf("%w: removing draft release failed: %s", err, derr)
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// publish uploads the release assets to a draft release, checks every asset
+// matches the uploaded file, and publishes the release unless it stays a
+// draft.
+func (m *Manifest) publish(ctx context.Context, client *github.Client, rel *github.RepositoryRelease, files []string, opts PublishOptions) (*PublishedRelease, error) {
+	owner, name, tag := m.Repo.Organization(), m.Repo.Name(), rel.GetTagName()
+
+	want := map[string]int64{}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err == nil {
+			want[filepath.Base(file)] = info.Size()
+			_, _, err = client.Repositories.UploadReleaseAsset(ctx, owner, name, rel.GetID(), &github.UploadOptions{Name: filepath.Base(file)}, f)
+		}
+		f.Close()
+		if err != nil {
+			return nil, NewError(ErrCodeInvalidRepo, m.Repo, tag, fmt.Errorf("uploading '%s': %s", filepath.Base(file), err))
+		}
+	}
+
+	// GitHub renames assets with unsupported characters, so every release
+	// file name is checked against the uploaded asset names
+	uploaded := map[string]int64{}
+	list := &github.ListOptions{PerPage: 100}
+	for {
+		assets, resp, err := client.Repositories.ListReleaseAssets(ctx, owner, name, rel.GetID(), list)
+		if err != nil {
+			return nil, NewError(ErrCodeInvalidRepo, m.Repo, tag, err)
+		}
+		for _, a := range assets {
+			uploaded[a.GetName()] = int64(a.GetSize())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		list.Page = resp.NextPage
+	}
+
+	p := &PublishedRelease{Repo: m.Repo, Version: semver.String(tag), Draft: true}
+	for _, file := range files {
+		n := filepath.Base(file)
+		size, ok := uploaded[n]
+		if !ok {
+			return nil, NewError(ErrCodeNotFound, m.Repo, tag, fmt.Errorf("release asset '%s' not found after upload, GitHub may have renamed it", n))
+		}
+		if size != want[n] {
+			return nil, NewError(ErrCodeUnknown, m.Repo, tag, fmt.Errorf("release asset '%s' is %d bytes, expected %d", n, size, want[n]))
+		}
+		p.Assets = append(p.Assets, &PublishedAsset{Name: n, Size: size})
+	}
+
+	if !opts.Draft {
+		published, _, err := client.Repositories.EditRelease(ctx, owner, name, rel.GetID(), &github.RepositoryRelease{Draft: github.Bool(false)})
+		if err != nil {
+			return nil, NewError(ErrCodeInvalidRepo, m.Repo, tag, err)
+		}
+		p.Draft = false
+		rel = published
+	}
+	p.URL = rel.GetHTMLURL()
+	return p, nil
+}
+
+// publishFiles checks the manifest can be published and returns the location
+// of every release file in a directory. Release files must have unique names,
+// and match the size and hash in the manifest when set.
+func (m *Manifest) publishFiles(dir string) ([]string, error) {
+	if err := m.Repo.Validate(); err != nil {
+		return nil, err
+	}
+	if err := ValidateVersion(m.Version); err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(string(m.Version), "<>=") {
+		return nil, NewError(ErrCodeInvalidInput, m.Repo, string(m.Version), fmt.Errorf("manifest version '%s' must be an exact version to publish", m.Version))
+	}
+
+	seen := map[string]bool{manifestName: true}
+	var files []string
+	for _, f := range m.Files {
+		if f.Name == "" || filepath.Base(f.Name) != f.Name || seen[f.Name] {
+			return nil, NewError(ErrCodeInvalidInput, m.Repo, string(m.Version), fmt.Errorf("invalid release file name '%s', names must be unique file names", f.Name))
+		}
+		seen[f.Name] = true
+
+		file := filepath.Join(dir, f.Name)
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, NewError(ErrCodeNotFound, m.Repo, string(m.Version), fmt.Errorf("release file '%s' not found in '%s'", f.Name, dir))
+		}
+		if f.Bytes > 0 && f.Bytes != info.Size() {
+			return nil, NewError(ErrCodeInvalidInput, m.Repo, string(m.Version), fmt.Errorf("release file '%s' is %d bytes, manifest size is %d", f.Name, info.Size(), f.Bytes))
+		}
+		if err := f.verifyHash(file); err != nil {
+			return nil, NewError(ErrCodeInvalidInput, m.Repo, string(m.Version), err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// stringOrNil returns a pointer to a string, or nil for an empty string.
+func stringOrNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -6,11 +6,15 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/google/go-github/v45/github"
 	"github.com/inhies/go-bytesize"
 )
 
+// releaseHashPrefix is the hash algorithm prefix for release file hashes.
+const releaseHashPrefix string = "sha256:"
+
 // ReleaseFile is an archived file for a mod release, hosted on GitHub releases.
 type ReleaseFile struct {
 	// Release file name.
@@ -20,10 +24,29 @@ type ReleaseFile struct {
 	// root of the archive.
 	Source string `json:"source,omitempty" yaml:"source,omitempty"`
 
-	// Destination is the folder path, relative to the game directory, where the
+	// Destination is the folder path, relative to the install root, where the
 	// mod content should be installed. Default is to the root of the game directory.
 	Destination string `json:"destination,omitempty" yaml:"destination,omitempty"`
 
+	// Root is the base directory the destination is relative to. One of game,
+	// documents, or appdata. Default is the game directory.
+	Root InstallRoot `json:"root,omitempty" yaml:"root,omitempty"`
+
+	// Plugins is the Bethesda plugins provided by the release file, with hints
+	// for where each plugin belongs in the load order.
+	Plugins []*PluginRule `json:"plugins,omitempty" yaml:"plugins,omitempty"`
+
+	// Choices is the options to select in each step and group of a FOMOD
+	// installer, so the release file installs the same way every time.
+	Choices []*FomodStepChoice `json:"choices,omitempty" yaml:"choices,omitempty"`
+
+	// Bytes is the release file size in bytes, set by swizzle pack.
+	Bytes int64 `json:"size,omitempty" yaml:"size,omitempty"`
+
+	// Hash is the SHA-256 hash of the release file in the form
+	// sha256:<hex>. Downloads which do not match the hash are removed.
+	Hash string `json:"hash,omitempty" yaml:"hash,omitempty"`
+
 	archive Archive
 	asset   *github.ReleaseAsset
 	size    int64
@@ -38,6 +61,7 @@ func (f *ReleaseFile) setReleaseAsset(assets []*github.ReleaseAsset) {
 	for _, a := range assets {
 		if a.GetName() == f.Name {
 			f.asset = a
+			f.size = int64(a.GetSize())
 		}
 	}
 }
@@ -56,10 +80,12 @@ func (f *ReleaseFile) download(
 ) {
 	if m == nil {
 		errCh <- fmt.Errorf("nil manifest")
+		return
 	}
 
 	if f.asset == nil {
-		errCh <- fmt.Errorf("nil manifest")
+		errCh <- NewError(ErrCodeNotFound, m.Repo, string(m.Version), fmt.Errorf("release file '%s' not found", f.Name))
+		return
 	}
 
 	cleanpath := filepath.Clean(path)
@@ -67,58 +93,117 @@ func (f *ReleaseFile) download(
 		err = os.MkdirAll(cleanpath, 0755)
 		if err != nil {
 			errCh <- err
+			return
 		}
 	}
 
 	resp, err := m.Repo.FetchReleaseAsset(ctx, f.asset)
 	if err != nil {
 		errCh <- err
+		return
 	}
 	defer resp.Body.Close()
 
-	f.archive = NewArchive(
-		fmt.Sprintf("%s-%s-%s", m.Repo.Name(), m.Version.Get(nil).String(), f.Name),
-		cleanpath,
-	)
+	f.archive = NewArchive(f.archiveName(m), cleanpath)
 
 	out, err := os.Create(f.archive.Location())
 	if err != nil {
 		errCh <- err
+		return
 	}
-	defer out.Close()
 
 	f.size = resp.ContentLength
 	progress := 0
-	chunkSize := 500
+	chunkSize := 32 * 1024
+	var buf = make([]byte, chunkSize)
 
 	for {
-		var buf = make([]byte, chunkSize)
-		err := readWriteChunk(resp.Body, out, buf)
-		if err != nil {
-			if err == io.EOF {
-				done <- true
+		n, err := readWriteChunk(resp.Body, out, buf)
+		progress = progress + n
+		if err == io.EOF {
+			if err := out.Close(); err != nil {
+				errCh <- err
+				return
 			}
-
+			if err := f.verifyHash(f.archive.Location()); err != nil {
+				os.Remove(f.archive.Location())
+				errCh <- NewError(ErrCodeUnknown, m.Repo, string(m.Version), err)
+				return
+			}
+			done <- true
+			return
+		}
+		if err != nil {
+			out.Close()
 			errCh <- err
+			return
+		}
+
+		if f.size > 0 {
+			prog <- 100 * float64(progress) / float64(f.size)
 		}
-		progress = progress + chunkSize
-		calc := 100 * float64(progress) / float64(f.size)
-		prog <- calc
 	}
 }
 
-func readWriteChunk(data io.ReadCloser, out *os.File, buf []byte) error {
-	r, err := data.Read(buf)
+// archiveName returns the file name for the downloaded release file, which is
+// prefixed with the repo name and release version.
+func (f *ReleaseFile) archiveName(m *Manifest) string {
+	return fmt.Sprintf("%s-%s-%s", m.Repo.Name(), m.Version.Get(nil).String(), f.Name)
+}
+
+// Archive returns the downloaded archive for the release file, or nil if the
+// release file has not been downloaded.
+func (f *ReleaseFile) Archive() Archive {
+	return f.archive
+}
+
+// Cached checks for a previously downloaded release file at the given folder
+// path. A cached file is only used when the size matches the release asset,
+// and the hash matches when the manifest sets one.
+func (f *ReleaseFile) Cached(path string, m *Manifest) bool {
+	a := NewArchive(f.archiveName(m), filepath.Clean(path))
+	info, err := os.Stat(a.Location())
+	if err != nil || info.IsDir() {
+		return false
+	}
+	if f.asset != nil && int64(f.asset.GetSize()) != info.Size() {
+		return false
+	}
+	if f.asset == nil && f.Bytes > 0 && f.Bytes != info.Size() {
+		return false
+	}
+	if f.verifyHash(a.Location()) != nil {
+		return false
+	}
+
+	f.archive = a
+	f.size = info.Size()
+	return true
+}
+
+// verifyHash checks a downloaded release file matches the release file hash,
+// when the manifest sets one.
+func (f *ReleaseFile) verifyHash(file string) error {
+	if f.Hash == "" {
+		return nil
+	}
+	hash, _, err := hashFile(file)
 	if err != nil {
 		return err
 	}
+	if !strings.EqualFold(releaseHashPrefix+hash, f.Hash) {
+		return fmt.Errorf("release file '%s' hash %s%s does not match %s", f.Name, releaseHashPrefix, hash, f.Hash)
+	}
+	return nil
+}
 
+func readWriteChunk(data io.ReadCloser, out *os.File, buf []byte) (int, error) {
+	r, err := data.Read(buf)
 	if r > 0 {
-		_, err = out.Write(buf[:r])
-		if err != nil {
-			return err
+		if _, werr := out.Write(buf[:r]); werr != nil {
+			return r, werr
 		}
 	}
 
-	return nil
+	return r, err
 }
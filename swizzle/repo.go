@@ -31,6 +31,28 @@ Example:
 */
 type Repo string
 
+// githubToken is the optional token for authenticated GitHub requests.
+var githubToken string
+
+// SetToken sets the GitHub token used for all GitHub API and release asset
+// requests. An empty token makes unauthenticated requests.
+func SetToken(token string) {
+	githubToken = token
+}
+
+// githubClient returns a GitHub API client, authenticated when a token is set.
+func githubClient() *github.Client {
+	if githubToken == "" {
+		return github.NewClient(http.DefaultClient)
+	}
+
+	tr := &github.BasicAuthTransport{
+		Username: "x-access-token",
+		Password: githubToken,
+	}
+	return github.NewClient(tr.Client())
+}
+
 // Organization returns the repo owner.
 func (r Repo) Organization() string {
 	return strings.Split(r.String(), "/")[0]
@@ -71,7 +93,7 @@ func (r Repo) LatestManifest(ctx context.Context) (*Manifest, error) {
 	}
 
 	if asset == nil {
-		return nil, fmt.Errorf("manifest not found")
+		return nil, NewError(ErrCodeNotFound, r, "latest", fmt.Errorf("manifest not found"))
 	}
 
 	return r.manifest(ctx, asset, release)
@@ -91,7 +113,7 @@ func (r Repo) Manifest(ctx context.Context, release *github.RepositoryRelease) (
 	}
 
 	if asset == nil {
-		return nil, fmt.Errorf("manifest not found")
+		return nil, NewError(ErrCodeNotFound, r, release.GetTagName(), fmt.Errorf("manifest not found"))
 	}
 
 	return r.manifest(ctx, asset, release)
@@ -131,7 +153,7 @@ func (r Repo) Release(ctx context.Context, version string) (*github.RepositoryRe
 
 	rel, err := r.Releases(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("invalid repo: %s", err)
+		return nil, NewError(ErrCodeInvalidRepo, r, version, fmt.Errorf("invalid repo: %s", err))
 	}
 
 	for _, d := range rel {
@@ -140,20 +162,20 @@ func (r Repo) Release(ctx context.Context, version string) (*github.RepositoryRe
 		}
 	}
 
-	return nil, fmt.Errorf("no release for version '%s'", ver.String())
+	return nil, NewError(ErrCodeNotFound, r, version, fmt.Errorf("no release for version '%s'", ver.String()))
 }
 
 // LatestRelease fetches the latest release for a repository.
 func (r Repo) LatestRelease(ctx context.Context) (*github.RepositoryRelease, error) {
-	client := github.NewClient(http.DefaultClient)
+	client := githubClient()
 	rel, res, err := client.Repositories.GetLatestRelease(ctx, r.Organization(), r.Name())
 	if err != nil {
-		return nil, fmt.Errorf("invalid repo: %s", err)
+		return nil, NewError(ErrCodeInvalidRepo, r, "latest", fmt.Errorf("invalid repo: %s", err))
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode > 299 {
-		return nil, fmt.Errorf("invalid repo")
+		return nil, NewError(ErrCodeInvalidRepo, r, "latest", fmt.Errorf("invalid repo"))
 	}
 
 	return rel, nil
@@ -161,15 +183,15 @@ func (r Repo) LatestRelease(ctx context.Context) (*github.RepositoryRelease, err
 
 // Releases fetches a list of releases from a repository.
 func (r Repo) Releases(ctx context.Context) ([]*github.RepositoryRelease, error) {
-	client := github.NewClient(http.DefaultClient)
+	client := githubClient()
 	rel, res, err := client.Repositories.ListReleases(ctx, r.Organization(), r.Name(), nil)
 	if err != nil {
-		return nil, err
+		return nil, NewError(ErrCodeInvalidRepo, r, "", err)
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode > 299 {
-		return nil, fmt.Errorf("invalid repo")
+		return nil, NewError(ErrCodeInvalidRepo, r, "", fmt.Errorf("invalid repo"))
 	}
 
 	return rel, nil
@@ -181,13 +203,18 @@ func (r Repo) FetchReleaseAsset(ctx context.Context, asset *github.ReleaseAsset)
 		return nil, fmt.Errorf("nil asset")
 	}
 
-	res, err := resty.New().R().
+	req := resty.New().R()
+	if githubToken != "" {
+		req.SetAuthToken(githubToken)
+	}
+
+	res, err := req.
 		SetDoNotParseResponse(true).
 		SetContext(ctx).
 		Get(asset.GetBrowserDownloadURL())
 
 	if res.StatusCode() == 404 {
-		return nil, fmt.Errorf("release file '%s' not found", asset.GetBrowserDownloadURL())
+		return nil, NewError(ErrCodeNotFound, r, "", fmt.Errorf("release file '%s' not found", asset.GetBrowserDownloadURL()))
 	}
 
 	return res.RawResponse, err
@@ -0,0 +1,507 @@
+package swizzle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const snapshotDir string = "snapshots"
+const objectDir string = "objects"
+
+// SnapshotFile is the recorded state of a single game file.
+type SnapshotFile struct {
+	DeployedPath
+
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+
+	// Repo is the mod which deployed the file, empty for game files.
+	Repo Repo `json:"repo,omitempty"`
+
+	// Backup is the hash of the original game file replaced by the deployed
+	// file.
+	Backup string `json:"backup,omitempty"`
+}
+
+// Snapshot is the recorded state of a game. The content of every deployed
+// file, every backed up original game file, and the settings and load order
+// files in the documents and app data directories is kept in the snapshot
+// object store, so the snapshot can be restored even after the staged mods or
+// backups change. Other game files are only recorded by hash.
+type Snapshot struct {
+	Name       string          `json:"name"`
+	Game       string          `json:"game"`
+	Created    time.Time       `json:"created"`
+	Deployment *Deployment     `json:"deployment"`
+	Files      []*SnapshotFile `json:"files"`
+}
+
+// SnapshotRestore is the result of restoring a snapshot.
+type SnapshotRestore struct {
+	Snapshot *Snapshot `json:"snapshot"`
+
+	// Deployment is the restored deployment.
+	Deployment *Deployment `json:"deployment"`
+
+	// Restored is every original game file restored from the snapshot.
+	Restored []DeployedPath `json:"restored"`
+
+	// Modified is every game file changed since the snapshot which could not
+	// be restored.
+	Modified []DeployedPath `json:"modified"`
+
+	// Missing is every game file removed since the snapshot which could not
+	// be restored.
+	Missing []DeployedPath `json:"missing"`
+}
+
+// snapshotPath returns the snapshot record location for a snapshot name.
+func (s *Staging) snapshotPath(name string) string {
+	return filepath.Join(s.Dir, snapshotDir, name+".json")
+}
+
+// objectPath returns the snapshot object store location for a file hash.
+func (s *Staging) objectPath(hash string) string {
+	return filepath.Join(s.Dir, snapshotDir, objectDir, hash[:2], hash)
+}
+
+// validateSnapshotName checks a snapshot name can be used as a file name.
+func validateSnapshotName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\:`) {
+		return NewError(ErrCodeInvalidInput, "", "", fmt.Errorf("invalid snapshot name '%s'", name))
+	}
+	return nil
+}
+
+// CreateSnapshot records the current state of the game install roots and the
+// deployment as a named snapshot.
+func (s *Staging) CreateSnapshot(g *GameConfig, name string) (*Snapshot, error) {
+	if err := validateSnapshotName(name); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(s.snapshotPath(name)); err == nil {
+		return nil, NewError(ErrCodeInvalidInput, "", "", fmt.Errorf("snapshot '%s' already exists", name))
+	}
+
+	d, err := s.Deployment()
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{
+		Name:       name,
+		Game:       g.Name,
+		Created:    time.Now().UTC(),
+		Deployment: d,
+	}
+
+	deployed := map[DeployedPath]*DeployedFile{}
+	for _, f := range d.Files {
+		deployed[pathKey(f.Root, f.Path)] = f
+		sf, err := s.snapshotFile(f)
+		if err != nil {
+			return nil, err
+		}
+		snap.Files = append(snap.Files, sf)
+	}
+
+	for _, root := range []InstallRoot{GameRoot, DocumentsRoot, AppDataRoot} {
+		files, err := s.snapshotRoot(g, root, deployed)
+		if err != nil {
+			return nil, err
+		}
+		snap.Files = append(snap.Files, files...)
+	}
+
+	sort.Slice(snap.Files, func(i, j int) bool {
+		if snap.Files[i].Root != snap.Files[j].Root {
+			return snap.Files[i].Root < snap.Files[j].Root
+		}
+		return snap.Files[i].Path < snap.Files[j].Path
+	})
+
+	b, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.snapshotPath(name)), 0755); err != nil {
+		return nil, err
+	}
+	return snap, os.WriteFile(s.snapshotPath(name), b, 0644)
+}
+
+// snapshotRoot records the files in an install root which were not deployed.
+// Every game directory file is recorded by hash. Only the files at the top of
+// the documents and app data directories are recorded, such as the game INI
+// and load order files, and their content is stored so they can be restored.
+// Install roots the game has no directory for are skipped.
+func (s *Staging) snapshotRoot(g *GameConfig, root InstallRoot, deployed map[DeployedPath]*DeployedFile) ([]*SnapshotFile, error) {
+	dir, err := g.RootDir(root)
+	if err != nil {
+		return nil, nil
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	var files []*SnapshotFile
+	err = filepath.WalkDir(dir, func(path string, e os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.IsDir() {
+			if root != GameRoot && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if _, ok := deployed[pathKey(root, rel)]; ok {
+			return nil
+		}
+
+		// only regular files and links to regular files are recorded
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		hash, size, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		if root != GameRoot {
+			if err := s.storeObject(hash, path); err != nil {
+				return err
+			}
+		}
+		files = append(files, &SnapshotFile{
+			DeployedPath: DeployedPath{Root: root, Path: rel},
+			Size:         size,
+			Hash:         hash,
+		})
+		return nil
+	})
+	return files, err
+}
+
+// snapshotFile hashes a deployed file and its backup, and adds both to the
+// snapshot object store.
+func (s *Staging) snapshotFile(f *DeployedFile) (*SnapshotFile, error) {
+	hash, size, err := hashFile(f.Source)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storeObject(hash, f.Source); err != nil {
+		return nil, err
+	}
+
+	sf := &SnapshotFile{
+		DeployedPath: f.DeployedPath,
+		Size:         size,
+		Hash:         hash,
+		Repo:         f.Repo,
+	}
+
+	if f.Backup != "" {
+		sf.Backup, _, err = hashFile(f.Backup)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.storeObject(sf.Backup, f.Backup); err != nil {
+			return nil, err
+		}
+	}
+	return sf, nil
+}
+
+// storeObject copies a file to the snapshot object store, and checks the
+// stored copy matches the hash. Objects are never linked to the file, so
+// later changes to the file do not change the snapshot.
+func (s *Staging) storeObject(hash, src string) error {
+	obj := s.objectPath(hash)
+	if current, _, err := hashFile(obj); err == nil && current == hash {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(obj), 0755); err != nil {
+		return err
+	}
+	if err := replaceFile(src, obj); err != nil {
+		return err
+	}
+
+	stored, _, err := hashFile(obj)
+	if err != nil {
+		return err
+	}
+	if stored != hash {
+		os.Remove(obj)
+		return fmt.Errorf("'%s' changed while adding it to the snapshot", src)
+	}
+	return nil
+}
+
+// Snapshot reads a snapshot record by name.
+func (s *Staging) Snapshot(name string) (*Snapshot, error) {
+	if err := validateSnapshotName(name); err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(s.snapshotPath(name))
+	if os.IsNotExist(err) {
+		return nil, NewError(ErrCodeNotFound, "", "", fmt.Errorf("snapshot '%s' not found", name))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return nil, fmt.Errorf("invalid snapshot '%s': %s", name, err)
+	}
+	return &snap, nil
+}
+
+// Snapshots returns all snapshots in the staging directory, oldest first.
+func (s *Staging) Snapshots() ([]*Snapshot, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Dir, snapshotDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snaps []*Snapshot
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		snap, err := s.Snapshot(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+
+	sort.SliceStable(snaps, func(i, j int) bool {
+		return snaps[i].Created.Before(snaps[j].Created)
+	})
+	return snaps, nil
+}
+
+// DeleteSnapshot removes a snapshot, and every object in the snapshot object
+// store no longer used by another snapshot.
+func (s *Staging) DeleteSnapshot(name string) (*Snapshot, error) {
+	snap, err := s.Snapshot(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(s.snapshotPath(name)); err != nil {
+		return nil, err
+	}
+
+	snaps, err := s.Snapshots()
+	if err != nil {
+		return snap, err
+	}
+	used := map[string]bool{}
+	for _, other := range snaps {
+		for _, f := range other.Files {
+			used[f.Hash] = true
+			used[f.Backup] = true
+		}
+	}
+
+	for _, f := range snap.Files {
+		for _, hash := range []string{f.Hash, f.Backup} {
+			if hash == "" || used[hash] {
+				continue
+			}
+			err := os.Remove(s.objectPath(hash))
+			if err != nil && !os.IsNotExist(err) {
+				return snap, err
+			}
+		}
+	}
+	return snap, nil
+}
+
+// RestoreSnapshot returns the game to the state recorded by a snapshot in a
+// transaction. The current deployment is purged, original game files are
+// restored from the snapshot, missing staged files are restored from the
+// snapshot object store, the snapshot deployment is deployed again and the
+// load order is written. Game files which changed since the snapshot and have
+// no stored content are reported as modified or missing. If any step fails,
+// every restored file is put back and the current deployment is redeployed.
+func (s *Staging) RestoreSnapshot(ctx context.Context, g *GameConfig, name string) (*SnapshotRestore, error) {
+	snap, err := s.Snapshot(name)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := s.Begin(g)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.restoreSnapshot(ctx, snap)
+	if err != nil {
+		return res, t.fail(err)
+	}
+	return res, t.Commit()
+}
+
+// restoreSnapshot purges the current deployment, restores the snapshot files,
+// deploys the snapshot deployment and writes the load order.
+func (t *Transaction) restoreSnapshot(ctx context.Context, snap *Snapshot) (*SnapshotRestore, error) {
+	res := &SnapshotRestore{Snapshot: snap}
+	if err := t.purge(); err != nil {
+		return res, err
+	}
+
+	files := map[DeployedPath]*SnapshotFile{}
+	for _, f := range snap.Files {
+		files[pathKey(f.Root, f.Path)] = f
+	}
+
+	p := &Plan{Mods: snap.Deployment.Mods}
+	for _, df := range snap.Deployment.Files {
+		f, ok := files[pathKey(df.Root, df.Path)]
+		if !ok {
+			return res, fmt.Errorf("snapshot '%s' is missing deployed file '%s'", snap.Name, df.Path)
+		}
+
+		if err := t.restoreObject(f.Hash, df.Source); err != nil {
+			return res, err
+		}
+		p.Files = append(p.Files, &StagedFile{
+			Root:    df.Root,
+			Path:    df.Path,
+			Source:  df.Source,
+			Size:    f.Size,
+			Repo:    df.Repo,
+			Version: df.Version,
+		})
+	}
+
+	for _, f := range snap.Files {
+		if f.Repo != "" && f.Backup == "" {
+			continue
+		}
+
+		rootDir, err := t.game.RootDir(f.Root)
+		if err != nil {
+			return res, err
+		}
+		target := filepath.Join(rootDir, filepath.FromSlash(f.Path))
+
+		// deployed files are compared with the original game file they replace
+		hash := f.Hash
+		if f.Repo != "" {
+			hash = f.Backup
+		}
+
+		current, _, err := hashFile(target)
+		if err == nil && current == hash {
+			continue
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return res, err
+		}
+
+		if _, serr := os.Stat(t.staging.objectPath(hash)); serr == nil {
+			if err := t.restoreObject(hash, target); err != nil {
+				return res, err
+			}
+			res.Restored = append(res.Restored, f.DeployedPath)
+		} else if os.IsNotExist(err) {
+			res.Missing = append(res.Missing, f.DeployedPath)
+		} else {
+			res.Modified = append(res.Modified, f.DeployedPath)
+		}
+	}
+
+	// restored INI files hold the snapshot INI settings, which are reverted
+	// so the deployment records the values they replaced
+	for _, set := range snap.Deployment.INI {
+		rootDir, err := t.game.RootDir(set.installRoot())
+		if err != nil {
+			return res, err
+		}
+		if err := t.save(newCaseResolver(rootDir).Resolve(cleanPath(set.File))); err != nil {
+			return res, err
+		}
+	}
+	if err := t.staging.revertINI(t.game, snap.Deployment.INI); err != nil {
+		return res, err
+	}
+	for _, set := range snap.Deployment.INI {
+		p.INI = append(p.INI, &set.INISetting)
+	}
+
+	method := snap.Deployment.Method
+	if method == "" {
+		method = HardlinkDeploy
+	}
+	d, err := t.Deploy(ctx, p, method)
+	if err != nil {
+		return res, err
+	}
+	res.Deployment = d
+	if _, err := t.WriteLoadOrder(); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// restoreObject replaces a file with the stored snapshot object when the file
+// is missing or its content does not match the hash. The replaced file is
+// saved, so it is put back on rollback.
+func (t *Transaction) restoreObject(hash, dst string) error {
+	current, _, err := hashFile(dst)
+	if err == nil && current == hash {
+		return nil
+	}
+
+	obj := t.staging.objectPath(hash)
+	if _, err := os.Stat(obj); err != nil {
+		return fmt.Errorf("snapshot object for '%s' is missing", dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := t.save(dst); err != nil {
+		return err
+	}
+	return replaceFile(obj, dst)
+}
+
+// hashFile returns the hex encoded sha256 hash and size of a file.
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,178 @@
+package swizzle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/afloesch/semver"
+)
+
+const stagedReleaseName string = "release.json"
+
+// Staging is the directory mod release files are extracted to before they are
+// deployed to a game. Each mod release is extracted once to
+// <staging>/<owner>/<repo>/<version>/<root>/, where root is the install root
+// for each release file.
+type Staging struct {
+	Dir string
+}
+
+// StagedFile is a single extracted file for a mod release.
+type StagedFile struct {
+	// Root is the install root the file is deployed relative to.
+	Root InstallRoot `json:"root"`
+
+	// Path is the slash separated file path relative to the install root.
+	Path string `json:"path"`
+
+	// Source is the location of the staged file.
+	Source string `json:"source,omitempty"`
+
+	// Size is the file size in bytes.
+	Size int64 `json:"size"`
+
+	Repo    Repo          `json:"repo"`
+	Version semver.String `json:"version"`
+}
+
+// StagedRelease is the record of the release files extracted for a staged mod
+// release, which is used to extract single files again from the cached
+// archives.
+type StagedRelease struct {
+	Repo    Repo             `json:"repo"`
+	Version semver.String    `json:"version"`
+	Files   []*StagedArchive `json:"files"`
+
+	// Dependency is the mods the release depends on. Records staged before
+	// dependencies were recorded have no dependency list.
+	Dependency []Repo `json:"dependency"`
+
+	// INI is the INI tweaks declared by the release manifest.
+	INI []*INITweak `json:"ini,omitempty"`
+}
+
+// StagedArchive is a release file extracted to the staging directory.
+type StagedArchive struct {
+	Name        string        `json:"name"`
+	Archive     string        `json:"archive"`
+	Source      string        `json:"source,omitempty"`
+	Root        InstallRoot   `json:"root"`
+	Destination string        `json:"destination,omitempty"`
+	Plugins     []*PluginRule `json:"plugins,omitempty"`
+
+	// FomodConfig is the archive path of the FOMOD installer config, empty
+	// when the release file was extracted without an installer.
+	FomodConfig string `json:"fomodConfig,omitempty"`
+
+	// Fomod is the options selected when the release file was installed with
+	// its FOMOD installer.
+	Fomod []*FomodStepChoice `json:"fomod,omitempty"`
+}
+
+// NewStaging returns the Staging for a directory.
+func NewStaging(dir string) *Staging {
+	return &Staging{Dir: filepath.Clean(dir)}
+}
+
+// ModDir returns the staging directory for a mod release.
+func (s *Staging) ModDir(repo Repo, version semver.String) string {
+	return filepath.Join(s.Dir, repo.Organization(), repo.Name(), version.Get().String())
+}
+
+// IsStaged checks whether a mod release has been extracted to the staging
+// directory.
+func (s *Staging) IsStaged(repo Repo, version semver.String) bool {
+	info, err := os.Stat(s.ModDir(repo, version))
+	return err == nil && info.IsDir()
+}
+
+// Stage extracts all downloaded release files for a mod release to the staging
+// directory, replacing any previously staged files for the release. Files are
+// extracted to a temporary directory first, so previously staged files are
+// kept if extracting fails.
+func (s *Staging) Stage(ctx context.Context, m *Manifest, opts ...StageOption) error {
+	t, err := s.Begin(nil)
+	if err != nil {
+		return err
+	}
+	if err := t.Stage(ctx, m, opts...); err != nil {
+		return t.fail(err)
+	}
+	return t.Commit()
+}
+
+// Release reads the staged release record for a mod release.
+func (s *Staging) Release(repo Repo, version semver.String) (*StagedRelease, error) {
+	b, err := ioutil.ReadFile(filepath.Join(s.ModDir(repo, version), stagedReleaseName))
+	if os.IsNotExist(err) {
+		return nil, NewError(ErrCodeNotFound, repo, string(version), fmt.Errorf("'%s' version '%s' has no staged release record, run 'swizzle install --restage'", repo, version))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var r StagedRelease
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("invalid staged release record: %s", err)
+	}
+	return &r, nil
+}
+
+// Files returns all staged files for a mod release sorted by path.
+func (s *Staging) Files(repo Repo, version semver.String) ([]*StagedFile, error) {
+	dir := s.ModDir(repo, version)
+	var files []*StagedFile
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		parts := strings.SplitN(filepath.ToSlash(rel), "/", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		files = append(files, &StagedFile{
+			Root:    InstallRoot(parts[0]),
+			Path:    parts[1],
+			Source:  path,
+			Size:    info.Size(),
+			Repo:    repo,
+			Version: version,
+		})
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, NewError(ErrCodeNotFound, repo, string(version), fmt.Errorf("'%s' version '%s' is not staged", repo, version))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Root != files[j].Root {
+			return files[i].Root < files[j].Root
+		}
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
@@ -0,0 +1,370 @@
+package swizzle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SteamGame is a game install found in a Steam library.
+type SteamGame struct {
+	// AppID is the Steam application id for the game.
+	AppID string `json:"appid"`
+
+	// Name is the Steam display name for the game.
+	Name string `json:"name"`
+
+	// Directory is the game install directory.
+	Directory string `json:"directory"`
+
+	// Library is the Steam library folder the game is installed in.
+	Library string `json:"library"`
+}
+
+// vdf is a parsed Valve KeyValues text document. Values are either strings or
+// nested vdf objects.
+type vdf map[string]interface{}
+
+// object returns the nested object for a key, matching the key case insensitively.
+func (v vdf) object(key string) vdf {
+	for k, val := range v {
+		if strings.EqualFold(k, key) {
+			if o, ok := val.(vdf); ok {
+				return o
+			}
+		}
+	}
+	return nil
+}
+
+// str returns the string value for a key, matching the key case insensitively.
+func (v vdf) str(key string) string {
+	for k, val := range v {
+		if strings.EqualFold(k, key) {
+			if s, ok := val.(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// SteamRoots returns the Steam install directories found on the system.
+func SteamRoots() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	candidates := []string{
+		filepath.Join(home, ".steam", "steam"),
+		filepath.Join(home, ".steam", "root"),
+		filepath.Join(home, ".local", "share", "Steam"),
+		filepath.Join(home, ".var", "app", "com.valvesoftware.Steam", ".local", "share", "Steam"),
+	}
+
+	var roots []string
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		dir, err := filepath.EvalSymlinks(c)
+		if err != nil || seen[dir] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, "steamapps")); err != nil {
+			continue
+		}
+		seen[dir] = true
+		roots = append(roots, dir)
+	}
+	return roots
+}
+
+// SteamLibraries returns all library folders for a Steam install, read from
+// steamapps/libraryfolders.vdf. The Steam install directory is always included.
+func SteamLibraries(root string) ([]string, error) {
+	libs := []string{root}
+
+	f, err := os.Open(filepath.Join(root, "steamapps", "libraryfolders.vdf"))
+	if os.IsNotExist(err) {
+		return libs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	doc, err := parseVDF(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid libraryfolders.vdf: %s", err)
+	}
+
+	folders := doc.object("libraryfolders")
+	if folders == nil {
+		return libs, nil
+	}
+
+	for _, v := range folders {
+		var path string
+		switch val := v.(type) {
+		case vdf:
+			path = val.str("path")
+		case string:
+			// Older Steam versions list library paths as plain values.
+			if filepath.IsAbs(val) {
+				path = val
+			}
+		}
+		if path != "" && filepath.Clean(path) != filepath.Clean(root) {
+			libs = append(libs, filepath.Clean(path))
+		}
+	}
+
+	sort.Strings(libs[1:])
+	return libs, nil
+}
+
+// SteamGames returns every installed game in a Steam library folder, read from
+// the steamapps/appmanifest_*.acf files.
+func SteamGames(library string) ([]*SteamGame, error) {
+	files, err := filepath.Glob(filepath.Join(library, "steamapps", "appmanifest_*.acf"))
+	if err != nil {
+		return nil, err
+	}
+
+	var games []*SteamGame
+	for _, file := range files {
+		g, err := readAppManifest(library, file)
+		if err != nil {
+			continue
+		}
+		games = append(games, g)
+	}
+	return games, nil
+}
+
+// FindSteamGames returns every game installed in all Steam libraries found on
+// the system.
+func FindSteamGames() ([]*SteamGame, error) {
+	var games []*SteamGame
+	seen := map[string]bool{}
+	for _, root := range SteamRoots() {
+		libs, err := SteamLibraries(root)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, lib := range libs {
+			found, err := SteamGames(lib)
+			if err != nil {
+				return nil, err
+			}
+			for _, g := range found {
+				if seen[g.Directory] {
+					continue
+				}
+				seen[g.Directory] = true
+				games = append(games, g)
+			}
+		}
+	}
+
+	sort.Slice(games, func(i, j int) bool {
+		return games[i].Name < games[j].Name
+	})
+	return games, nil
+}
+
+// FindGameInstalls returns the Steam game installs which contain the game
+// executable.
+func FindGameInstalls(executable string) ([]*SteamGame, error) {
+	games, err := FindSteamGames()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*SteamGame
+	for _, g := range games {
+		if g.HasExecutable(executable) {
+			matches = append(matches, g)
+		}
+	}
+	return matches, nil
+}
+
+// HasExecutable checks whether the game directory contains the executable. File
+// names are compared case insensitively.
+func (g *SteamGame) HasExecutable(executable string) bool {
+	if executable == "" {
+		return false
+	}
+
+	entries, err := os.ReadDir(g.Directory)
+	if err != nil {
+		return false
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() && strings.EqualFold(e.Name(), executable) {
+			return true
+		}
+	}
+	return false
+}
+
+// readAppManifest parses a Steam appmanifest_*.acf file.
+func readAppManifest(library, file string) (*SteamGame, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	doc, err := parseVDF(f)
+	if err != nil {
+		return nil, err
+	}
+
+	state := doc.object("AppState")
+	if state == nil || state.str("installdir") == "" {
+		return nil, fmt.Errorf("invalid app manifest '%s'", file)
+	}
+
+	return &SteamGame{
+		AppID:     state.str("appid"),
+		Name:      state.str("name"),
+		Directory: filepath.Join(library, "steamapps", "common", state.str("installdir")),
+		Library:   library,
+	}, nil
+}
+
+// parseVDF parses a Valve KeyValues text document.
+func parseVDF(r io.Reader) (vdf, error) {
+	tokens, err := vdfTokens(r)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, rest, err := parseVDFObject(tokens, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected token '%s'", rest[0])
+	}
+	return doc, nil
+}
+
+// parseVDFObject parses key value pairs until the closing brace of a nested
+// object, or the end of the tokens for the document root.
+func parseVDFObject(tokens []string, nested bool) (vdf, []string, error) {
+	obj := vdf{}
+	for len(tokens) > 0 {
+		key := tokens[0]
+		tokens = tokens[1:]
+
+		if key == "}" {
+			if !nested {
+				return nil, nil, fmt.Errorf("unexpected '}'")
+			}
+			return obj, tokens, nil
+		}
+		if key == "{" {
+			return nil, nil, fmt.Errorf("unexpected '{'")
+		}
+		if len(tokens) == 0 {
+			return nil, nil, fmt.Errorf("missing value for key '%s'", key)
+		}
+
+		if tokens[0] == "{" {
+			child, rest, err := parseVDFObject(tokens[1:], true)
+			if err != nil {
+				return nil, nil, err
+			}
+			obj[key] = child
+			tokens = rest
+			continue
+		}
+
+		obj[key] = tokens[0]
+		tokens = tokens[1:]
+	}
+
+	if nested {
+		return nil, nil, fmt.Errorf("missing '}'")
+	}
+	return obj, nil, nil
+}
+
+// vdfTokens splits a KeyValues document into quoted strings, unquoted words and
+// braces. Comments starting with // are skipped.
+func vdfTokens(r io.Reader) ([]string, error) {
+	var tokens []string
+	br := bufio.NewReader(r)
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case c == '{' || c == '}':
+			tokens = append(tokens, string(c))
+		case c == '"':
+			var s strings.Builder
+			for {
+				c, _, err = br.ReadRune()
+				if err != nil {
+					return nil, fmt.Errorf("unterminated string")
+				}
+				if c == '"' {
+					break
+				}
+				if c == '\\' {
+					next, _, err := br.ReadRune()
+					if err != nil {
+						return nil, fmt.Errorf("unterminated string")
+					}
+					switch next {
+					case 'n':
+						c = '\n'
+					case 't':
+						c = '\t'
+					default:
+						c = next
+					}
+				}
+				s.WriteRune(c)
+			}
+			tokens = append(tokens, s.String())
+		case c == '/':
+			next, _, _ := br.ReadRune()
+			if next != '/' {
+				return nil, fmt.Errorf("unexpected '/'")
+			}
+			br.ReadString('\n')
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		default:
+			var s strings.Builder
+			s.WriteRune(c)
+			for {
+				next, _, err := br.ReadRune()
+				if err != nil {
+					break
+				}
+				if strings.ContainsRune(" \t\r\n{}\"", next) {
+					br.UnreadRune()
+					break
+				}
+				s.WriteRune(next)
+			}
+			tokens = append(tokens, s.String())
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package swizzle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const transactionPrefix string = ".txn-"
+
+// Transaction is an install which is either applied completely or not at
+// all. Mod releases are extracted to a temporary directory in the staging
+// directory and moved into place with renames, and the previous deployment is
+// restored if any step fails or the context is canceled.
+type Transaction struct {
+	staging *Staging
+	game    *GameConfig
+	dir     string
+
+	// previous is the deployment in place when the transaction began.
+	previous *Deployment
+	purged   bool
+
+	// deployed is the deployment created by the transaction.
+	deployed *Deployment
+
+	// swapped is every mod directory replaced by the transaction in order.
+	swapped []swap
+
+	// saved is every file changed by the transaction outside a deployment
+	// in order.
+	saved []savedFile
+}
+
+// swap is a staged mod directory replaced by a transaction, and the location
+// of the previously staged files.
+type swap struct {
+	dir string
+	old string
+}
+
+// savedFile is a file changed by a transaction, and the location of a copy of
+// its previous content, which is empty when the file did not exist.
+type savedFile struct {
+	path string
+	copy string
+}
+
+// Begin starts a transaction for the staging directory. The game may be nil
+// for transactions which only stage mod releases.
+func (s *Staging) Begin(g *GameConfig) (*Transaction, error) {
+	previous, err := s.Deployment()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(s.Dir, transactionPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transaction{
+		staging:  s,
+		game:     g,
+		dir:      dir,
+		previous: previous,
+	}, nil
+}
+
+// Stage extracts all downloaded release files for a mod release to a
+// temporary directory, then replaces any previously staged files for the
+// release with a rename. The previously staged files are restored on rollback.
+func (t *Transaction) Stage(ctx context.Context, m *Manifest, opts ...StageOption) error {
+	o := &stageOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	tmp := filepath.Join(t.dir, "new", strconv.Itoa(len(t.swapped)))
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return err
+	}
+
+	rec := &StagedRelease{Repo: m.Repo, Version: m.Version, Dependency: m.sortedDependencies(), INI: m.INI}
+	for _, f := range m.Files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := f.validateRoot(m); err != nil {
+			return err
+		}
+		if f.archive == nil {
+			return NewError(ErrCodeNotFound, m.Repo, string(m.Version), fmt.Errorf("release file '%s' not downloaded", f.Name))
+		}
+
+		archive, err := filepath.Abs(f.archive.Location())
+		if err != nil {
+			return err
+		}
+		staged := &StagedArchive{
+			Name:        f.Name,
+			Archive:     archive,
+			Source:      f.Source,
+			Root:        f.InstallRoot(),
+			Destination: f.Destination,
+			Plugins:     f.Plugins,
+		}
+
+		// the destination comes from a remote manifest, so it is kept inside
+		// the staging directory
+		dst := filepath.Join(tmp, string(f.InstallRoot()), filepath.FromSlash(cleanPath(f.Destination)))
+		config, err := fomodConfigName(f.archive, f.Source)
+		if err != nil {
+			return fmt.Errorf("'%s' %s: %w", f.Name, m.Repo, err)
+		}
+		if config != "" {
+			staged.FomodConfig = config
+			extract := filepath.Join(t.dir, "fomod", strconv.Itoa(len(t.swapped)), strconv.Itoa(len(rec.Files)))
+			staged.Fomod, err = o.installFomod(ctx, m, f, config, extract, dst)
+		} else {
+			err = f.archive.Unpack(dst, f.Source, MergeCase(), WithContext(ctx))
+		}
+		if err != nil {
+			return fmt.Errorf("'%s' %s: %w", f.Name, m.Repo, err)
+		}
+		rec.Files = append(rec.Files, staged)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, stagedReleaseName), b, 0644); err != nil {
+		return err
+	}
+
+	dir := t.staging.ModDir(m.Repo, m.Version)
+	sw := swap{dir: dir}
+	if _, err := os.Stat(dir); err == nil {
+		sw.old = filepath.Join(t.dir, "old", strconv.Itoa(len(t.swapped)))
+		if err := os.MkdirAll(filepath.Dir(sw.old), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(dir, sw.old); err != nil {
+			return err
+		}
+	} else if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+
+	t.swapped = append(t.swapped, sw)
+	return os.Rename(tmp, dir)
+}
+
+// Deploy removes the previous deployment from the game, then deploys the
+// staged files in the plan. Original game files replaced by deployed files
+// are backed up in the staging directory. The deployment record is saved when
+// the transaction is committed.
+func (t *Transaction) Deploy(ctx context.Context, p *Plan, method DeployMethod) (*Deployment, error) {
+	if err := t.purge(); err != nil {
+		return nil, err
+	}
+
+	d := &Deployment{
+		Method: method,
+		Mods:   p.Mods,
+	}
+	t.deployed = d
+
+	resolvers := map[InstallRoot]*caseResolver{}
+	for _, f := range p.Files {
+		if err := ctx.Err(); err != nil {
+			return d, err
+		}
+
+		rootDir, err := t.game.RootDir(f.Root)
+		if err != nil {
+			return d, err
+		}
+
+		r, ok := resolvers[f.Root]
+		if !ok {
+			r = newCaseResolver(rootDir)
+			resolvers[f.Root] = r
+		}
+
+		target := r.Resolve(f.Path)
+		rel, err := filepath.Rel(rootDir, target)
+		if err != nil {
+			return d, err
+		}
+
+		hash, _, err := hashFile(f.Source)
+		if err != nil {
+			return d, err
+		}
+
+		df := &DeployedFile{
+			DeployedPath: DeployedPath{Root: f.Root, Path: filepath.ToSlash(rel)},
+			Source:       f.Source,
+			Repo:         f.Repo,
+			Version:      f.Version,
+			Method:       method,
+			Hash:         hash,
+		}
+
+		// record the file before deploying so a partial deploy is rolled back
+		d.Files = append(d.Files, df)
+		if err := t.staging.deployFile(rootDir, target, df, method, d); err != nil {
+			return d, err
+		}
+	}
+
+	// INI tweaks are applied after the files, so tweaks can edit INI files
+	// deployed by mods
+	for _, set := range p.INI {
+		di, err := t.staging.applyINI(t.game, set, d)
+		if di != nil {
+			d.INI = append(d.INI, di)
+		}
+		if err != nil {
+			return d, err
+		}
+	}
+
+	return d, nil
+}
+
+// deployment returns the deployment created by the transaction, or the
+// previous deployment when the transaction has not deployed.
+func (t *Transaction) deployment() *Deployment {
+	if t.deployed != nil {
+		return t.deployed
+	}
+	return t.previous
+}
+
+// purge removes the previous deployment from the game, unless the
+// transaction already removed it.
+func (t *Transaction) purge() error {
+	if t.game == nil {
+		return fmt.Errorf("transaction has no game to deploy to")
+	}
+	if t.purged {
+		return nil
+	}
+
+	t.purged = true
+	return t.staging.purge(t.game, t.previous)
+}
+
+// save copies a file to the transaction directory before the transaction
+// changes it, so the file is put back on rollback.
+func (t *Transaction) save(path string) error {
+	for _, sf := range t.saved {
+		if sf.path == path {
+			return nil
+		}
+	}
+
+	sf := savedFile{path: path}
+	if _, err := os.Stat(path); err == nil {
+		sf.copy = filepath.Join(t.dir, "saved", strconv.Itoa(len(t.saved)))
+		if err := os.MkdirAll(filepath.Dir(sf.copy), 0755); err != nil {
+			return err
+		}
+		if err := copyFile(path, sf.copy); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	t.saved = append(t.saved, sf)
+	return nil
+}
+
+// Commit saves the deployment record and removes the previously staged files
+// replaced by the transaction.
+func (t *Transaction) Commit() error {
+	if t.deployed != nil {
+		if err := t.staging.writeDeployment(t.deployed); err != nil {
+			return t.fail(err)
+		}
+	}
+	return os.RemoveAll(t.dir)
+}
+
+// Rollback removes everything deployed by the transaction, restores the
+// previously staged files for every replaced mod release and every saved
+// file, and redeploys the previous deployment.
+func (t *Transaction) Rollback() error {
+	var errs []string
+	if t.deployed != nil {
+		if err := t.staging.purge(t.game, t.deployed); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	for i := len(t.swapped) - 1; i >= 0; i-- {
+		sw := t.swapped[i]
+		if err := os.RemoveAll(sw.dir); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if sw.old != "" {
+			if err := os.Rename(sw.old, sw.dir); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+
+	for i := len(t.saved) - 1; i >= 0; i-- {
+		sf := t.saved[i]
+		var err error
+		if sf.copy != "" {
+			err = replaceFile(sf.copy, sf.path)
+		} else if err = os.Remove(sf.path); os.IsNotExist(err) {
+			err = nil
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if t.purged {
+		if err := t.restore(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if err := os.RemoveAll(t.dir); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// fail rolls back the transaction and returns the original error.
+func (t *Transaction) fail(err error) error {
+	if rerr := t.Rollback(); rerr != nil {
+		return fmt.Errorf("%w: rollback failed: %s", err, rerr)
+	}
+	return err
+}
+
+// restore redeploys the previous deployment and saves its record.
+func (t *Transaction) restore() error {
+	d := &Deployment{
+		Method: t.previous.Method,
+		Mods:   t.previous.Mods,
+	}
+
+	for _, f := range t.previous.Files {
+		rootDir, err := t.game.RootDir(f.Root)
+		if err != nil {
+			return err
+		}
+
+		df := *f
+		df.Backup = ""
+		d.Files = append(d.Files, &df)
+
+		target := filepath.Join(rootDir, filepath.FromSlash(f.Path))
+		if df.isDeployed(target) {
+			df.Backup = f.Backup
+			continue
+		}
+		if err := t.staging.deployFile(rootDir, target, &df, df.Method, d); err != nil {
+			return err
+		}
+	}
+
+	for _, set := range t.previous.INI {
+		di, err := t.staging.applyINI(t.game, &set.INISetting, d)
+		if di != nil {
+			d.INI = append(d.INI, di)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// directories which were not removed by the purge are still deployed, and
+	// come before any recreated directories so they are removed last
+	created := map[DeployedPath]bool{}
+	for _, dir := range d.Dirs {
+		created[*dir] = true
+	}
+	var dirs []*DeployedPath
+	for _, dir := range t.previous.Dirs {
+		if !created[*dir] {
+			dirs = append(dirs, dir)
+		}
+	}
+	d.Dirs = append(dirs, d.Dirs...)
+
+	if len(d.Files) == 0 && len(d.INI) == 0 {
+		err := os.Remove(filepath.Join(t.staging.Dir, deploymentName))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return t.staging.writeDeployment(d)
+}
@@ -0,0 +1,228 @@
+package swizzle
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestFiles writes files with their content relative to a directory.
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTestFiles returns the content of every file relative to a directory.
+func readTestFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// testPlan stages files with their content and returns a plan deploying them
+// to the game root.
+func testPlan(t *testing.T, dir string, files map[string]string) *Plan {
+	t.Helper()
+	writeTestFiles(t, dir, files)
+	p := &Plan{}
+	for name := range files {
+		p.Files = append(p.Files, &StagedFile{
+			Root:   GameRoot,
+			Path:   name,
+			Source: filepath.Join(dir, filepath.FromSlash(name)),
+			Repo:   "test/mod",
+		})
+	}
+	return p
+}
+
+func TestTransactionRollback(t *testing.T) {
+	tests := []struct {
+		name     string
+		game     map[string]string
+		previous map[string]string
+		deploy   map[string]string
+		want     map[string]string
+	}{
+		{
+			name:   "new files are removed",
+			game:   map[string]string{"Skyrim.exe": "game"},
+			deploy: map[string]string{"Data/mod.esp": "mod"},
+			want:   map[string]string{"Skyrim.exe": "game"},
+		},
+		{
+			name:   "replaced game files are restored",
+			game:   map[string]string{"Data/Skyrim.esm": "original"},
+			deploy: map[string]string{"Data/Skyrim.esm": "mod", "Data/mod.esp": "mod"},
+			want:   map[string]string{"Data/Skyrim.esm": "original"},
+		},
+		{
+			name:     "previous deployment is redeployed",
+			game:     map[string]string{"Data/Skyrim.esm": "original"},
+			previous: map[string]string{"Data/Skyrim.esm": "v1", "Data/old.esp": "v1"},
+			deploy:   map[string]string{"Data/Skyrim.esm": "v2", "Data/new.esp": "v2"},
+			want:     map[string]string{"Data/Skyrim.esm": "v1", "Data/old.esp": "v1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := &Staging{Dir: filepath.Join(dir, "staging")}
+			g := &GameConfig{Directory: filepath.Join(dir, "game")}
+			writeTestFiles(t, g.Directory, tt.game)
+
+			if tt.previous != nil {
+				p := testPlan(t, filepath.Join(dir, "v1"), tt.previous)
+				if _, err := s.Deploy(context.Background(), g, p, CopyDeploy); err != nil {
+					t.Fatal(err)
+				}
+			}
+			previous, err := s.Deployment()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			txn, err := s.Begin(g)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := testPlan(t, filepath.Join(dir, "v2"), tt.deploy)
+			if _, err := txn.Deploy(context.Background(), p, CopyDeploy); err != nil {
+				t.Fatal(err)
+			}
+			if err := txn.Rollback(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := readTestFiles(t, g.Directory); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("game files: got %v, want %v", got, tt.want)
+			}
+			if _, err := os.Stat(txn.dir); !os.IsNotExist(err) {
+				t.Errorf("transaction directory not removed: %v", err)
+			}
+
+			d, err := s.Deployment()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(d.Files) != len(previous.Files) {
+				t.Errorf("deployment record: got %d files, want %d", len(d.Files), len(previous.Files))
+			}
+		})
+	}
+}
+
+func TestTransactionRollbackSaved(t *testing.T) {
+	dir := t.TempDir()
+	s := &Staging{Dir: filepath.Join(dir, "staging")}
+	writeTestFiles(t, dir, map[string]string{"plugins.txt": "*A.esp\n"})
+	existing := filepath.Join(dir, "plugins.txt")
+	missing := filepath.Join(dir, "loadorder.txt")
+
+	txn, err := s.Begin(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{existing, missing, existing} {
+		if err := txn.save(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(txn.saved) != 2 {
+		t.Errorf("got %d saved files, want 2", len(txn.saved))
+	}
+
+	writeTestFiles(t, dir, map[string]string{"plugins.txt": "*B.esp\n", "loadorder.txt": "B.esp\n"})
+	if err := txn.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := os.ReadFile(existing); err != nil || string(b) != "*A.esp\n" {
+		t.Errorf("existing file: got %q, %v, want %q", b, err, "*A.esp\n")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("missing file not removed: %v", err)
+	}
+}
+
+func TestTransactionRollbackSwapped(t *testing.T) {
+	tests := []struct {
+		name string
+		old  map[string]string
+	}{
+		{"previously staged release is restored", map[string]string{"Data/mod.esp": "v1"}},
+		{"new release is removed", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Staging{Dir: t.TempDir()}
+			mod := s.ModDir("test/mod", "v1.0.0")
+			if tt.old != nil {
+				writeTestFiles(t, mod, tt.old)
+			}
+
+			txn, err := s.Begin(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// replace the staged release the same way Stage does
+			sw := swap{dir: mod}
+			if tt.old != nil {
+				sw.old = filepath.Join(txn.dir, "old", "0")
+				if err := os.MkdirAll(filepath.Dir(sw.old), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Rename(mod, sw.old); err != nil {
+					t.Fatal(err)
+				}
+			}
+			txn.swapped = append(txn.swapped, sw)
+			writeTestFiles(t, mod, map[string]string{"Data/mod.esp": "v2"})
+
+			if err := txn.Rollback(); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.old == nil {
+				if _, err := os.Stat(mod); !os.IsNotExist(err) {
+					t.Errorf("staged release not removed: %v", err)
+				}
+				return
+			}
+			if got := readTestFiles(t, mod); !reflect.DeepEqual(got, tt.old) {
+				t.Errorf("got %v, want %v", got, tt.old)
+			}
+		})
+	}
+}
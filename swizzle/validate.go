@@ -0,0 +1,28 @@
+package swizzle
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/afloesch/semver"
+)
+
+var repoRe = regexp.MustCompile(`^[A-Za-z0-9-]+/[A-Za-z0-9._-]+$`)
+var versionRe = regexp.MustCompile(`^(>=|<=|>|<)?v?\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// Validate checks the repo is a GitHub repository name in the owner/name format.
+func (r Repo) Validate() error {
+	if !repoRe.MatchString(r.String()) {
+		return NewError(ErrCodeInvalidInput, r, "", fmt.Errorf("invalid repo '%s': must be in the format owner/name", r))
+	}
+	return nil
+}
+
+// ValidateVersion checks the version is a semantic version with an optional
+// comparison operator, for example ">=v1.2.0".
+func ValidateVersion(version semver.String) error {
+	if !versionRe.MatchString(string(version)) {
+		return NewError(ErrCodeInvalidInput, "", string(version), fmt.Errorf("invalid version '%s': must be a semantic version like '>=v1.0.0'", version))
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package swizzle
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/afloesch/semver"
+)
+
+// ModVerification is the result of verifying the deployed files for a mod.
+type ModVerification struct {
+	Repo    Repo          `json:"repo"`
+	Version semver.String `json:"version"`
+
+	// Files is the number of files deployed by the mod.
+	Files int `json:"files"`
+
+	// Missing is every deployed file removed from the game.
+	Missing []DeployedPath `json:"missing"`
+
+	// Modified is every deployed file changed since it was installed.
+	Modified []DeployedPath `json:"modified"`
+
+	// Extra is every file added to a directory created by the mod which was
+	// not deployed.
+	Extra []DeployedPath `json:"extra"`
+}
+
+// OK is true when no deployed files for the mod are missing or modified.
+func (v *ModVerification) OK() bool {
+	return len(v.Missing) == 0 && len(v.Modified) == 0
+}
+
+// Verification is the result of verifying every deployed file against the
+// hash recorded when it was deployed.
+type Verification struct {
+	Mods []*ModVerification `json:"mods"`
+}
+
+// OK is true when no deployed files are missing or modified.
+func (v *Verification) OK() bool {
+	for _, m := range v.Mods {
+		if !m.OK() {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify compares every deployed file in the game with the hash recorded when
+// it was deployed, and finds files added to directories created by the
+// deployment. Files deployed before hashes were recorded are only checked for
+// existence.
+func (s *Staging) Verify(g *GameConfig) (*Verification, error) {
+	d, err := s.Deployment()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Verification{}
+	mods := map[Repo]*ModVerification{}
+	for _, m := range d.Mods {
+		mv := &ModVerification{Repo: m.Repo, Version: m.Version}
+		mods[m.Repo] = mv
+		v.Mods = append(v.Mods, mv)
+	}
+	mod := func(f *DeployedFile) *ModVerification {
+		mv, ok := mods[f.Repo]
+		if !ok {
+			mv = &ModVerification{Repo: f.Repo, Version: f.Version}
+			mods[f.Repo] = mv
+			v.Mods = append(v.Mods, mv)
+		}
+		return mv
+	}
+
+	deployed := map[DeployedPath]bool{}
+	for _, f := range d.Files {
+		deployed[pathKey(f.Root, f.Path)] = true
+		mv := mod(f)
+		mv.Files++
+
+		status, err := f.verify(g)
+		if err != nil {
+			return nil, err
+		}
+		switch status {
+		case missingFile:
+			mv.Missing = append(mv.Missing, f.DeployedPath)
+		case modifiedFile:
+			mv.Modified = append(mv.Modified, f.DeployedPath)
+		}
+	}
+
+	// INI files edited by the deployment are not extra files
+	for _, set := range d.INI {
+		deployed[pathKey(set.installRoot(), cleanPath(set.File))] = true
+	}
+
+	for _, dir := range d.Dirs {
+		rootDir, err := g.RootDir(dir.Root)
+		if err != nil {
+			return nil, err
+		}
+
+		entries, err := os.ReadDir(filepath.Join(rootDir, filepath.FromSlash(dir.Path)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// extra files belong to the first mod deployed to the directory
+		owner := dirOwner(d, dir)
+		for _, e := range entries {
+			p := path.Join(dir.Path, e.Name())
+			if e.IsDir() || deployed[pathKey(dir.Root, p)] || owner == nil {
+				continue
+			}
+			mv := mod(owner)
+			mv.Extra = append(mv.Extra, DeployedPath{Root: dir.Root, Path: p})
+		}
+	}
+
+	return v, nil
+}
+
+// fileStatus is the state of a deployed file in the game.
+type fileStatus int
+
+const (
+	okFile fileStatus = iota
+	missingFile
+	modifiedFile
+)
+
+// verify compares the deployed file in the game with the recorded hash.
+func (f *DeployedFile) verify(g *GameConfig) (fileStatus, error) {
+	rootDir, err := g.RootDir(f.Root)
+	if err != nil {
+		return okFile, err
+	}
+
+	hash, _, err := hashFile(filepath.Join(rootDir, filepath.FromSlash(f.Path)))
+	if os.IsNotExist(err) {
+		return missingFile, nil
+	}
+	if err != nil {
+		return okFile, err
+	}
+	if f.Hash != "" && hash != f.Hash {
+		return modifiedFile, nil
+	}
+	return okFile, nil
+}
+
+// dirOwner returns the first deployed file inside a created directory.
+func dirOwner(d *Deployment, dir *DeployedPath) *DeployedFile {
+	prefix := lowerPath(dir.Path) + "/"
+	for _, f := range d.Files {
+		if f.Root == dir.Root && strings.HasPrefix(lowerPath(f.Path), prefix) {
+			return f
+		}
+	}
+	return nil
+}
+
+// Repair deploys every missing or modified file again. Staged files which no
+// longer match the recorded hash are extracted again from the cached release
+// files. The verification before the repair and the repaired files are
+// returned.
+func (s *Staging) Repair(g *GameConfig) (*Verification, []*DeployedFile, error) {
+	v, err := s.Verify(g)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	broken := map[DeployedPath]bool{}
+	for _, m := range v.Mods {
+		for _, p := range append(m.Missing, m.Modified...) {
+			broken[pathKey(p.Root, p.Path)] = true
+		}
+	}
+
+	d, err := s.Deployment()
+	if err != nil {
+		return v, nil, err
+	}
+
+	var repaired []*DeployedFile
+	for _, f := range d.Files {
+		if !broken[pathKey(f.Root, f.Path)] {
+			continue
+		}
+
+		if err := s.repairSource(f); err != nil {
+			return v, repaired, err
+		}
+
+		rootDir, err := g.RootDir(f.Root)
+		if err != nil {
+			return v, repaired, err
+		}
+		target := filepath.Join(rootDir, filepath.FromSlash(f.Path))
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return v, repaired, err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return v, repaired, err
+		}
+		if err := f.link(target, f.Method); err != nil {
+			return v, repaired, err
+		}
+		if err := d.reapplyINI(f, target); err != nil {
+			return v, repaired, err
+		}
+		repaired = append(repaired, f)
+	}
+
+	return v, repaired, s.writeDeployment(d)
+}
+
+// repairSource extracts a staged file again from the cached release file when
+// it no longer matches the recorded hash.
+func (s *Staging) repairSource(f *DeployedFile) error {
+	want := f.SourceHash
+	if want == "" {
+		want = f.Hash
+	}
+	if want == "" {
+		if _, err := os.Stat(f.Source); err == nil {
+			return nil
+		}
+	} else if hash, _, err := hashFile(f.Source); err == nil && hash == want {
+		return nil
+	}
+
+	rel, err := filepath.Rel(s.ModDir(f.Repo, f.Version), f.Source)
+	if err != nil {
+		return err
+	}
+	rel = lowerPath(filepath.ToSlash(rel))
+
+	r, err := s.Release(f.Repo, f.Version)
+	if err != nil {
+		return err
+	}
+
+	// later release files overwrite earlier ones when staged
+	for i := len(r.Files) - 1; i >= 0; i-- {
+		a := r.Files[i]
+		prefix := lowerPath(path.Join(string(a.Root), path.Clean("/" + filepath.ToSlash(a.Destination))[1:]))
+		if !strings.HasPrefix(rel, prefix+"/") {
+			continue
+		}
+		name := strings.TrimPrefix(rel, prefix+"/")
+
+		// files installed by a FOMOD installer do not keep their archive paths
+		if a.FomodConfig != "" {
+			return NewError(ErrCodeIncompatible, f.Repo, string(f.Version), fmt.Errorf("'%s' was installed with a FOMOD installer, restage it with 'swizzle install --restage'", a.Name))
+		}
+
+		ok, err := a.extract(name, f.Source)
+		if err != nil {
+			return fmt.Errorf("'%s' %s: %w", a.Name, f.Repo, err)
+		}
+		if !ok {
+			continue
+		}
+
+		if want != "" {
+			hash, _, err := hashFile(f.Source)
+			if err != nil {
+				return err
+			}
+			if hash != want {
+				return NewError(ErrCodeIncompatible, f.Repo, string(f.Version), fmt.Errorf("'%s' in '%s' does not match the installed file", name, a.Name))
+			}
+		}
+		return nil
+	}
+
+	return NewError(ErrCodeNotFound, f.Repo, string(f.Version), fmt.Errorf("no release file contains '%s'", f.Path))
+}
+
+// extract replaces dst with a single file from the cached archive. False is
+// returned when the archive does not contain the file.
+func (a *StagedArchive) extract(name, dst string) (bool, error) {
+	if _, err := os.Stat(a.Archive); err != nil {
+		return false, NewError(ErrCodeNotFound, "", "", fmt.Errorf("cached release file '%s' is missing, download it again with 'swizzle install --restage'", a.Archive))
+	}
+
+	archive := NewArchive(filepath.Base(a.Archive), filepath.Dir(a.Archive))
+	files, err := archive.List(a.Source)
+	if err != nil {
+		return false, err
+	}
+
+	found := ""
+	for _, f := range files {
+		if lowerPath(f.Name) == name {
+			found = f.Name
+		}
+	}
+	if found == "" {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return false, err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dst), transactionPrefix)
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := archive.Unpack(tmp, a.Source, OnlyFiles(found)); err != nil {
+		return false, err
+	}
+	return true, os.Rename(filepath.Join(tmp, filepath.FromSlash(found)), dst)
+}